@@ -4,10 +4,14 @@ import (
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	docs "main/docs"
+	"main/src/commands"
+	"main/src/mail"
 	"main/src/models"
 	"main/src/models/structur"
 	"main/src/routes"
+	"main/src/storage"
 	"main/src/utils"
+	"os"
 )
 
 func main() {
@@ -19,6 +23,30 @@ func main() {
 	models.AutoMigrateModels()
 	structur.AutoMigrateComics()
 
+	// Хранилище изображений: локальный диск или S3
+	storage.Open()
+
+	// Консольные подкоманды, например: main import-chapter -comic <slug> -number 1 chapter.cbz.
+	// Им нужны только база и хранилище, поэтому ключи JWT, 2FA и почта для них не настраиваются.
+	if len(os.Args) > 1 {
+		os.Exit(commands.Run(os.Args[1:]))
+	}
+
+	// Ключи подписи и проверки JWT
+	models.OpenSigningKeys()
+	// Ключ шифрования секретов 2FA
+	models.OpenTOTPKey()
+
+	// Отправка писем: журнал, файлы или SMTP
+	mail.Open()
+
+	// Фоновая очистка корзины комиксов
+	structur.StartTrashPurger()
+	// Фоновое удаление брошенных загрузок
+	structur.StartUploadPurger()
+	// Фоновое удаление просроченных refresh токенов
+	models.StartTokenPurger()
+
 	r := routes.SetupRoutes()
 
 	// Настройка Swagger
@@ -0,0 +1,113 @@
+// Package comicinfo читает и записывает ComicInfo.xml - метаданные в формате ComicRack,
+// которые понимают Kavita, Komga и большинство читалок CBZ.
+package comicinfo
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FileName - имя файла метаданных внутри CBZ архива
+const FileName = "ComicInfo.xml"
+
+// Значения поля Manga
+const (
+	MangaUnknown           = "Unknown"
+	MangaNo                = "No"
+	MangaYes               = "Yes"
+	MangaYesAndRightToLeft = "YesAndRightToLeft"
+)
+
+// ComicInfo - подмножество схемы ComicInfo v2.0, которое мы используем.
+// Пустые поля не попадают в XML при экспорте.
+type ComicInfo struct {
+	XMLName         xml.Name `xml:"ComicInfo"`
+	XMLNSXsi        string   `xml:"xmlns:xsi,attr,omitempty"`
+	XMLNSXsd        string   `xml:"xmlns:xsd,attr,omitempty"`
+	Title           string   `xml:"Title,omitempty"`
+	Series          string   `xml:"Series,omitempty"`
+	Number          string   `xml:"Number,omitempty"`
+	Count           int      `xml:"Count,omitempty"`
+	Volume          int      `xml:"Volume,omitempty"`
+	AlternateSeries string   `xml:"AlternateSeries,omitempty"`
+	Summary         string   `xml:"Summary,omitempty"`
+	Notes           string   `xml:"Notes,omitempty"`
+	Year            int      `xml:"Year,omitempty"`
+	Month           int      `xml:"Month,omitempty"`
+	Day             int      `xml:"Day,omitempty"`
+	Writer          string   `xml:"Writer,omitempty"`
+	Penciller       string   `xml:"Penciller,omitempty"`
+	Inker           string   `xml:"Inker,omitempty"`
+	Colorist        string   `xml:"Colorist,omitempty"`
+	Letterer        string   `xml:"Letterer,omitempty"`
+	CoverArtist     string   `xml:"CoverArtist,omitempty"`
+	Editor          string   `xml:"Editor,omitempty"`
+	Translator      string   `xml:"Translator,omitempty"`
+	Publisher       string   `xml:"Publisher,omitempty"`
+	Genre           string   `xml:"Genre,omitempty"`
+	Tags            string   `xml:"Tags,omitempty"`
+	Web             string   `xml:"Web,omitempty"`
+	PageCount       int      `xml:"PageCount,omitempty"`
+	LanguageISO     string   `xml:"LanguageISO,omitempty"`
+	Format          string   `xml:"Format,omitempty"`
+	Manga           string   `xml:"Manga,omitempty"`
+	ScanInformation string   `xml:"ScanInformation,omitempty"`
+	AgeRating       string   `xml:"AgeRating,omitempty"`
+	CommunityRating float32  `xml:"CommunityRating,omitempty"`
+	Pages           *Pages   `xml:"Pages,omitempty"`
+}
+
+type Pages struct {
+	Page []Page `xml:"Page"`
+}
+
+type Page struct {
+	Image       int    `xml:"Image,attr"`
+	Type        string `xml:"Type,attr,omitempty"`
+	ImageWidth  int    `xml:"ImageWidth,attr,omitempty"`
+	ImageHeight int    `xml:"ImageHeight,attr,omitempty"`
+}
+
+// Parse читает ComicInfo.xml
+func Parse(r io.Reader) (*ComicInfo, error) {
+	var info ComicInfo
+	if err := xml.NewDecoder(r).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", FileName, err)
+	}
+	return &info, nil
+}
+
+// Write записывает ComicInfo.xml с XML заголовком
+func Write(w io.Writer, info *ComicInfo) error {
+	info.XMLNSXsi = "http://www.w3.org/2001/XMLSchema-instance"
+	info.XMLNSXsd = "http://www.w3.org/2001/XMLSchema"
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(info); err != nil {
+		return fmt.Errorf("failed to write %s: %w", FileName, err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// SplitList разбирает списковые поля (Genre, Tags), разделённые запятыми
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// JoinList собирает списковое поле из значений
+func JoinList(items []string) string {
+	return strings.Join(items, ", ")
+}
@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"main/src/models/structur"
+)
+
+// checkStorage сверяет хранилище изображений с базой: находит файлы, на которые нет ссылок,
+// и записи, файлов которых нет в хранилище. По умолчанию только печатает отчёт:
+//
+//	main check-storage -delete-orphans -mark-broken -min-age 48h
+func checkStorage(args []string) error {
+	flags := flag.NewFlagSet("check-storage", flag.ContinueOnError)
+	deleteOrphans := flags.Bool("delete-orphans", false, "удалить файлы, на которые нет ссылок в базе")
+	markBroken := flags.Bool("mark-broken", false, "отметить комиксы и страницы без файлов признаком broken")
+	minAge := flags.Duration("min-age", structur.DefaultOrphanMinAge, "не считать лишними файлы моложе указанного срока")
+	verbose := flags.Bool("v", false, "вывести ключи лишних и отсутствующих файлов")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := structur.CheckStorage(*minAge)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Objects in storage: %d\n", report.Objects)
+	fmt.Printf("Orphaned objects: %d (%d bytes)\n", len(report.Orphans), report.OrphanBytes)
+	if *verbose {
+		for _, orphan := range report.Orphans {
+			fmt.Printf("  orphan  %s (%d bytes, %s)\n", orphan.Key, orphan.Size, orphan.ModTime.Format("2006-01-02 15:04"))
+		}
+	}
+	fmt.Printf("Missing files: %d\n", len(report.Missing))
+	if *verbose {
+		for _, missing := range report.Missing {
+			fmt.Printf("  missing %-14s comic %d chapter %d page %d: %s\n", missing.Kind, missing.ComicsID, missing.ChapterID, missing.PageID, missing.Key)
+		}
+	}
+
+	if *markBroken {
+		// Пустое хранилище скорее означает неверные STORAGE_* настройки, чем потерю всех файлов
+		if report.Objects == 0 && len(report.Missing) > 0 {
+			return errors.New("storage is empty, check STORAGE_DRIVER and its settings before marking records as broken")
+		}
+		comics, pages, err := structur.MarkBroken(report)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Marked %d comics and %d pages as broken\n", comics, pages)
+	}
+
+	if *deleteOrphans {
+		deleted, err := structur.DeleteOrphans(report)
+		fmt.Printf("Deleted %d orphaned objects\n", deleted)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
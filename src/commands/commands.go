@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+)
+
+// command - консольная подкоманда приложения
+type command struct {
+	description string
+	run         func(args []string) error
+}
+
+var registry = map[string]command{
+	"check-storage": {
+		description: "сверка хранилища изображений с базой и очистка лишних файлов",
+		run:         checkStorage,
+	},
+	"hash-images": {
+		description: "вычисление хэшей изображений для поиска дубликатов",
+		run:         hashImages,
+	},
+	"import-chapter": {
+		description: "импорт главы комикса из CBZ/ZIP архива",
+		run:         importChapter,
+	},
+	"purge-trash": {
+		description: "окончательное удаление комиксов из корзины",
+		run:         purgeTrash,
+	},
+	"set-role": {
+		description: "назначение роли пользователю",
+		run:         setRole,
+	},
+}
+
+// Run выполняет подкоманду из аргументов командной строки и возвращает код завершения
+func Run(args []string) int {
+	cmd, ok := registry[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\nAvailable commands:\n", args[0])
+		for name, c := range registry {
+			fmt.Fprintf(os.Stderr, "  %-20s %s\n", name, c.description)
+		}
+		return 2
+	}
+
+	if err := cmd.run(args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,28 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"main/src/models/structur"
+)
+
+// hashImages вычисляет перцептивные хэши обложек и страниц, загруженных до появления
+// поиска дубликатов, чтобы они участвовали в проверке и в списке /admin/duplicates:
+//
+//	main hash-images
+func hashImages(args []string) error {
+	flags := flag.NewFlagSet("hash-images", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	result, err := structur.BackfillHashes()
+	fmt.Printf("Hashed %d covers and %d pages\n", result.Covers, result.Pages)
+	if result.Uninformative > 0 {
+		fmt.Printf("%d images are flat and have no hash, they will not be read again\n", result.Uninformative)
+	}
+	if result.Failed > 0 {
+		fmt.Printf("%d images could not be read, see the log; run the command again to retry\n", result.Failed)
+	}
+	return err
+}
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"main/src/models/structur"
+	"os"
+	"time"
+)
+
+// importChapter импортирует главу из архива:
+//
+//	main import-chapter -comic <slug> [-number 12.5] [-volume 2] [-title ...] [-language ru] [-team ...] chapter.cbz
+//
+// Без -number номер берётся из ComicInfo.xml архива, а если его нет - следующий за последней главой.
+func importChapter(args []string) error {
+	flags := flag.NewFlagSet("import-chapter", flag.ContinueOnError)
+	slug := flags.String("comic", "", "slug комикса (alternative_name)")
+	number := flags.Float64("number", -1, "номер главы, по умолчанию из ComicInfo.xml или следующий за последней главой")
+	volume := flags.Int("volume", 0, "номер тома")
+	title := flags.String("title", "", "название главы")
+	language := flags.String("language", "", "язык перевода")
+	team := flags.String("team", "", "команда переводчиков")
+	publishedAt := flags.String("published-at", "", "дата публикации в формате RFC3339")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *slug == "" || flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("comic and exactly one archive path are required")
+	}
+
+	comic, err := structur.GetComicsBySlug(*slug)
+	if err != nil {
+		return fmt.Errorf("comic %q: %w", *slug, err)
+	}
+
+	chapter := structur.Chapter{
+		Volume:         *volume,
+		Number:         *number,
+		Title:          *title,
+		Language:       *language,
+		TranslatorTeam: *team,
+	}
+	if *publishedAt != "" {
+		chapter.PublishedAt, err = time.Parse(time.RFC3339, *publishedAt)
+		if err != nil {
+			return fmt.Errorf("invalid published-at: %w", err)
+		}
+	}
+
+	archive, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	info, err := archive.Stat()
+	if err != nil {
+		return err
+	}
+
+	imported, err := structur.ImportChapterArchive(comic, &chapter, archive, info.Size(), 0)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported chapter %g (id %d) with %d pages into %q\n", imported.Number, imported.ID, len(imported.Pages), comic.Name)
+	for _, duplicate := range imported.Duplicates {
+		fmt.Printf("Warning: %d pages match chapter %g (id %d) of %q\n", duplicate.MatchedPages, duplicate.ChapterNumber, duplicate.ChapterID, duplicate.Name)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"main/src/models/structur"
+)
+
+// purgeTrash окончательно удаляет комиксы из корзины, не дожидаясь фоновой очистки:
+//
+//	main purge-trash -older-than 0s
+func purgeTrash(args []string) error {
+	flags := flag.NewFlagSet("purge-trash", flag.ContinueOnError)
+	olderThan := flags.Duration("older-than", structur.TrashRetention(), "удалить комиксы, пролежавшие в корзине дольше указанного срока")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	purged, err := structur.PurgeTrash(*olderThan)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Purged %d comics from trash\n", purged)
+	return nil
+}
@@ -0,0 +1,37 @@
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"main/src/models"
+)
+
+// setRole назначает роль пользователю, например первому администратору:
+//
+//	main set-role -email admin@example.com -role admin
+func setRole(args []string) error {
+	flags := flag.NewFlagSet("set-role", flag.ContinueOnError)
+	email := flags.String("email", "", "email пользователя")
+	role := flags.String("role", "", "роль: reader, translator, moderator или admin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *email == "" || *role == "" {
+		flags.Usage()
+		return errors.New("email and role are required")
+	}
+
+	user := models.FetchUserByEmail(*email)
+	if user.ID == 0 {
+		return fmt.Errorf("user %q not found", *email)
+	}
+
+	if _, err := models.SetUserRole(user.ID, models.Role(*role)); err != nil {
+		return err
+	}
+
+	fmt.Printf("User %q is now %s\n", *email, *role)
+	return nil
+}
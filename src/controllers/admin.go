@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"errors"
+	"main/src/models"
+	"main/src/models/structur"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type SetRoleDTO struct {
+	Role models.Role `json:"role" binding:"required"`
+}
+
+// SetUserRole godoc
+// @Summary Назначить роль пользователю
+// @Description Назначение роли (reader, translator, moderator, admin). Доступно только администраторам.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param id path int true "ID пользователя"
+// @Param role body SetRoleDTO true "Новая роль"
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/users/{id}/role [put]
+func SetUserRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid user id", "data": nil})
+		return
+	}
+
+	var input SetRoleDTO
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+
+	user, err := models.SetUserRole(uint(id), input.Role)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "User not found", "data": nil})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Role updated successfully", "data": user.Response()})
+}
+
+// GetAuditLogs godoc
+// @Summary Журнал аудита
+// @Description Обращения к маршрутам, защищённым правами, от новых к старым. Доступно только администраторам.
+// @Tags Admin
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param user_id query int false "Фильтр по ID пользователя"
+// @Param limit query int false "Количество записей (до 200)"
+// @Param offset query int false "Смещение"
+// @Success 200 {array} models.AuditLog
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /admin/audit [get]
+func GetAuditLogs(c *gin.Context) {
+	userId, _ := strconv.ParseUint(c.Query("user_id"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	logs, err := models.GetAuditLogs(uint(userId), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Get audit logs successful", "data": logs})
+}
+
+// GetDuplicateComics godoc
+// @Summary Предполагаемые дубликаты комиксов
+// @Description Пары комиксов с похожими обложками по перцептивному хэшу, от самых похожих. Доступно модераторам и администраторам.
+// @Tags Admin
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param threshold query int false "Максимальное расстояние Хэмминга между хэшами (0-16), по умолчанию DUPLICATE_THRESHOLD"
+// @Param limit query int false "Количество пар (до 200)"
+// @Param offset query int false "Смещение"
+// @Success 200 {array} structur.DuplicatePair
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /admin/duplicates [get]
+func GetDuplicateComics(c *gin.Context) {
+	threshold, err := strconv.Atoi(c.Query("threshold"))
+	if err != nil || threshold < 0 || threshold > structur.MaxDuplicatePairsThreshold {
+		threshold = structur.DuplicateThreshold()
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	pairs, err := structur.GetDuplicateComics(threshold, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Get duplicate comics successful", "data": pairs})
+}
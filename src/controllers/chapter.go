@@ -0,0 +1,440 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"main/src/comicinfo"
+	"main/src/models"
+	"main/src/models/structur"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ReorderChaptersDTO struct {
+	ChapterIDs []uint `json:"chapter_ids" binding:"required"`
+}
+
+// findComicsBySlug ищет комикс по slug из пути и сам пишет ответ об ошибке
+func findComicsBySlug(c *gin.Context) (*structur.Comics, bool) {
+	comic, err := structur.GetComicsBySlug(c.Param("slug"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Comic not found", "data": nil})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		}
+		return nil, false
+	}
+	return comic, true
+}
+
+// findVisibleComics ищет комикс, как findComicsBySlug, но скрытый комикс находят только те,
+// кто может его видеть. Иначе главы и страницы скрытого комикса можно было бы получить в обход GetComics.
+func findVisibleComics(c *gin.Context) (*structur.Comics, bool) {
+	comic, ok := findComicsBySlug(c)
+	if !ok {
+		return nil, false
+	}
+	if comic.Hidden && !callerCan(c, models.PermComicsViewHidden) {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Comic not found", "data": nil})
+		return nil, false
+	}
+	return comic, true
+}
+
+// parseChapterID извлекает идентификатор главы из пути
+func parseChapterID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid chapter id", "data": nil})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// bindChapterForm заполняет данные главы из полей multipart формы.
+// Если номер необязателен и не передан, он остаётся отрицательным.
+func bindChapterForm(c *gin.Context, numberRequired bool) (*structur.Chapter, bool) {
+	chapter := structur.Chapter{Number: -1}
+	var err error
+	if value := c.PostForm("number"); value != "" || numberRequired {
+		chapter.Number, err = strconv.ParseFloat(value, 64)
+		if err != nil || chapter.Number < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid chapter number", "data": nil})
+			return nil, false
+		}
+	}
+
+	if volume, err := strconv.Atoi(c.PostForm("volume")); err == nil {
+		chapter.Volume = volume
+	}
+	if publishedAt := c.PostForm("published_at"); publishedAt != "" {
+		chapter.PublishedAt, err = time.Parse(time.RFC3339, publishedAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid published_at, RFC3339 expected", "data": nil})
+			return nil, false
+		}
+	}
+	chapter.Title = c.PostForm("title")
+	chapter.Language = c.PostForm("language")
+	chapter.TranslatorTeam = c.PostForm("translator_team")
+	return &chapter, true
+}
+
+// GetChapters godoc
+// @Summary Список глав комикса
+// @Description Получить список глав комикса в порядке отображения
+// @Tags Chapters
+// @Produce json
+// @Param Authorization header string false "API Key in Bearer format"
+// @Param slug path string true "Slug комикса (alternative_name)"
+// @Success 200 {array} structur.Chapter
+// @Failure 404 {object} map[string]interface{}
+// @Router /comics/{slug}/chapters [get]
+func GetChapters(c *gin.Context) {
+	comic, ok := findVisibleComics(c)
+	if !ok {
+		return
+	}
+
+	chapters, err := structur.GetChapters(comic.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Get chapters successful", "data": chapters})
+}
+
+// GetChapter godoc
+// @Summary Получить главу
+// @Description Получить главу комикса вместе со страницами. Страницы раздаются только по подписанным адресам из url,
+// @Description которые действуют PAGE_URL_TTL. При PAGE_URL_BIND_USER=true адреса вошедшего читателя привязываются к нему.
+// @Description Так же подписывается адрес скачивания главы архивом в export_url. Скрытые комиксы доступны только модераторам и администраторам.
+// @Tags Chapters
+// @Produce json
+// @Param Authorization header string false "API Key in Bearer format"
+// @Param slug path string true "Slug комикса (alternative_name)"
+// @Param id path int true "ID главы"
+// @Success 200 {object} structur.Chapter
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /comics/{slug}/chapters/{id} [get]
+func GetChapter(c *gin.Context) {
+	comic, ok := findVisibleComics(c)
+	if !ok {
+		return
+	}
+	chapter, ok := findChapter(c, comic)
+	if !ok {
+		return
+	}
+	chapter.SignPages(callerID(c))
+	chapter.ExportURL = c.Request.URL.EscapedPath() + "/export?" + chapter.SignExport(comic.AlternativeName, callerID(c))
+
+	c.Header("Cache-Control", "private, no-store")
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Get chapter successful", "data": chapter})
+}
+
+// CreateChapter godoc
+// @Summary Создать главу
+// @Description Создание главы комикса. Страницы загружаются файлами в поле pages в порядке чтения.
+// @Description У вебтунов страницы выше WEBTOON_SLICE_HEIGHT режутся на части по пустым промежуткам между панелями, а фрагменты ниже WEBTOON_STITCH_HEIGHT склеиваются с соседними.
+// @Description Если большая часть страниц совпадает со страницами другой главы, в ответе возвращаются duplicates, а при DUPLICATE_POLICY=reject глава не создаётся (409).
+// @Tags Chapters
+// @Accept multipart/form-data
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param slug path string true "Slug комикса (alternative_name)"
+// @Param volume formData int false "Номер тома"
+// @Param number formData number true "Номер главы (например 12.5)"
+// @Param title formData string false "Название главы"
+// @Param language formData string false "Язык перевода"
+// @Param translator_team formData string false "Команда переводчиков"
+// @Param published_at formData string false "Дата публикации в формате RFC3339"
+// @Param pages formData file false "Страницы главы: JPEG, PNG, GIF или WebP до 50 МБ каждая"
+// @Success 201 {object} structur.Chapter
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /comics/{slug}/chapters [post]
+func CreateChapter(c *gin.Context) {
+	comic, ok := findComicsBySlug(c)
+	if !ok {
+		return
+	}
+
+	chapter, ok := bindChapterForm(c, true)
+	if !ok {
+		return
+	}
+
+	// Получение файлов страниц (необязательно, главу можно заполнить позже импортом)
+	var pages []io.Reader
+	if form, err := c.MultipartForm(); err == nil {
+		for _, file := range form.File["pages"] {
+			stream, err := file.Open()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to open page " + file.Filename, "data": nil})
+				return
+			}
+			defer stream.Close()
+			pages = append(pages, stream)
+		}
+	}
+
+	chapterResponse, err := structur.CreateChapter(comic, chapter, pages)
+	var validation *structur.ValidationError
+	if errors.As(err, &validation) {
+		validationFailed(c, validation)
+		return
+	}
+	var duplicate *structur.DuplicateError
+	if errors.As(err, &duplicate) {
+		duplicateRejected(c, duplicate)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"status": "success", "message": withDuplicatesNote("Chapter created successfully", chapterResponse.Duplicates), "data": chapterResponse})
+}
+
+// ImportChapter godoc
+// @Summary Импорт главы из архива
+// @Description Создание главы из CBZ/ZIP архива. Изображения архива сортируются по имени файла и становятся страницами.
+// @Description Если хотя бы одна страница не прошла проверку, глава не создаётся.
+// @Description ComicInfo.xml из архива заполняет незаданные поля главы и пустые поля комикса.
+// @Description Повторная загрузка уже существующей главы обрабатывается так же, как при создании главы.
+// @Tags Chapters
+// @Accept multipart/form-data
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param slug path string true "Slug комикса (alternative_name)"
+// @Param archive formData file false "CBZ/ZIP архив главы"
+// @Param archive_upload formData string false "ID завершённой загрузки (POST /uploads) вместо файла archive, для больших архивов"
+// @Param volume formData int false "Номер тома"
+// @Param number formData number false "Номер главы (например 12.5), по умолчанию из ComicInfo.xml, а без него следующий за последней главой"
+// @Param title formData string false "Название главы"
+// @Param language formData string false "Язык перевода"
+// @Param translator_team formData string false "Команда переводчиков"
+// @Param published_at formData string false "Дата публикации в формате RFC3339"
+// @Success 201 {object} structur.Chapter
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /comics/{slug}/chapters/import [post]
+func ImportChapter(c *gin.Context) {
+	comic, ok := findComicsBySlug(c)
+	if !ok {
+		return
+	}
+
+	chapter, ok := bindChapterForm(c, false)
+	if !ok {
+		return
+	}
+
+	archiveStream, archiveSize, archiveUpload, err := openFormFile(c, "archive")
+	if errors.Is(err, http.ErrMissingFile) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Archive is required", "data": nil})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Failed to open archive: " + err.Error(), "data": nil})
+		return
+	}
+	defer archiveStream.Close()
+
+	chapterResponse, err := structur.ImportChapterArchive(comic, chapter, archiveStream, archiveSize, callerID(c))
+	var validation *structur.ValidationError
+	if errors.As(err, &validation) {
+		validationFailed(c, validation)
+		return
+	}
+	var duplicate *structur.DuplicateError
+	if errors.As(err, &duplicate) {
+		duplicateRejected(c, duplicate)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+
+	structur.RemoveUpload(archiveUpload)
+
+	c.JSON(http.StatusCreated, gin.H{"status": "success", "message": withDuplicatesNote("Chapter imported successfully", chapterResponse.Duplicates), "data": chapterResponse})
+}
+
+// findChapter ищет главу комикса по id из пути и сам пишет ответ об ошибке
+func findChapter(c *gin.Context, comic *structur.Comics) (*structur.Chapter, bool) {
+	chapterID, ok := parseChapterID(c)
+	if !ok {
+		return nil, false
+	}
+
+	chapter, err := structur.GetChapter(comic.ID, chapterID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Chapter not found", "data": nil})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		}
+		return nil, false
+	}
+	return chapter, true
+}
+
+// GetChapterComicInfo godoc
+// @Summary ComicInfo.xml главы
+// @Description Получить метаданные главы в формате ComicInfo.xml (ComicRack, Kavita, Komga)
+// @Tags Chapters
+// @Produce xml
+// @Param Authorization header string false "API Key in Bearer format"
+// @Param slug path string true "Slug комикса (alternative_name)"
+// @Param id path int true "ID главы"
+// @Success 200 {string} string "ComicInfo.xml"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /comics/{slug}/chapters/{id}/comicinfo [get]
+func GetChapterComicInfo(c *gin.Context) {
+	comic, ok := findVisibleComics(c)
+	if !ok {
+		return
+	}
+	chapter, ok := findChapter(c, comic)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "application/xml; charset=utf-8")
+	if err := comicinfo.Write(c.Writer, structur.ComicInfoFor(comic, chapter)); err != nil {
+		c.Error(err)
+	}
+}
+
+// ExportChapter godoc
+// @Summary Экспорт главы в CBZ
+// @Description Скачать главу CBZ архивом со страницами и ComicInfo.xml. Архив отдаётся только по подписанному адресу
+// @Description из export_url главы (GET /comics/{slug}/chapters/{id}): без подписи, с чужой или истёкшей подписью - 403.
+// @Tags Chapters
+// @Produce application/zip
+// @Param Authorization header string false "API Key in Bearer format"
+// @Param slug path string true "Slug комикса (alternative_name)"
+// @Param id path int true "ID главы"
+// @Param expires query int true "Срок действия подписанного адреса, Unix time"
+// @Param uid query int false "Пользователь, к которому привязан адрес"
+// @Param sig query string true "Подпись адреса"
+// @Success 200 {file} file "CBZ архив"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /comics/{slug}/chapters/{id}/export [get]
+func ExportChapter(c *gin.Context) {
+	comic, ok := findVisibleComics(c)
+	if !ok {
+		return
+	}
+	chapter, ok := findChapter(c, comic)
+	if !ok {
+		return
+	}
+	// Архив содержит все страницы главы, поэтому защищён так же, как адреса страниц
+	if _, ok := verifySignedURL(c, structur.ExportKey(comic.AlternativeName, chapter.ID)); !ok {
+		return
+	}
+
+	filename := fmt.Sprintf("%s - %s.cbz", comic.AlternativeName, strconv.FormatFloat(chapter.Number, 'f', -1, 64))
+	c.Header("Cache-Control", "private, no-store")
+	c.Header("Content-Type", "application/vnd.comicbook+zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	if err := structur.ExportChapterArchive(comic, chapter, c.Writer); err != nil {
+		// Заголовки уже отправлены, поэтому остаётся только обрыв архива и запись в лог
+		c.Error(err)
+	}
+}
+
+// ReorderChapters godoc
+// @Summary Изменить порядок глав
+// @Description Задать порядок отображения глав комикса. Список должен содержать все главы комикса.
+// @Tags Chapters
+// @Accept json
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param slug path string true "Slug комикса (alternative_name)"
+// @Param order body ReorderChaptersDTO true "ID глав в новом порядке"
+// @Success 200 {array} structur.Chapter
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /comics/{slug}/chapters/order [put]
+func ReorderChapters(c *gin.Context) {
+	comic, ok := findComicsBySlug(c)
+	if !ok {
+		return
+	}
+
+	var input ReorderChaptersDTO
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+
+	chapters, err := structur.ReorderChapters(comic.ID, input.ChapterIDs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Chapters reordered successfully", "data": chapters})
+}
+
+// DeleteChapter godoc
+// @Summary Удалить главу
+// @Description Удаление главы комикса вместе со страницами
+// @Tags Chapters
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param slug path string true "Slug комикса (alternative_name)"
+// @Param id path int true "ID главы"
+// @Success 200 {object} structur.Chapter
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /comics/{slug}/chapters/{id} [delete]
+func DeleteChapter(c *gin.Context) {
+	comic, ok := findComicsBySlug(c)
+	if !ok {
+		return
+	}
+	chapterID, ok := parseChapterID(c)
+	if !ok {
+		return
+	}
+
+	chapter, err := structur.DeleteChapter(comic, chapterID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Chapter not found", "data": nil})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Chapter deleted successfully", "data": chapter})
+}
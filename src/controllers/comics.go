@@ -1,18 +1,26 @@
 package controllers
 
 import (
+	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/lib/pq"
 	"gorm.io/gorm"
+	"io"
+	"main/src/models"
 	"main/src/models/structur"
+	"mime/multipart"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // GetComicsInfo godoc
 // @Summary Получить информацию о комиксе
-// @Description Получить детальную информацию о комиксе по имени
+// @Description Получить детальную информацию о комиксе по точному имени. Устарело: используйте /comics/{slug} или /comics/search.
 // @Tags Comics
+// @Deprecated
 // @Accept json
 // @Produce json
 // @Security Name  // Указывает, что требуется API ключ
@@ -39,66 +47,408 @@ func GetComicsInfo(c *gin.Context) {
 		}
 		return
 	}
+	if comicInfo.Hidden && !callerCan(c, models.PermComicsViewHidden) {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Comic not found", "data": nil})
+		return
+	}
 
 	// Формируем успешный ответ с информацией о комиксе
 	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Get info successful", "data": comicInfo})
 }
 
+// GetComics godoc
+// @Summary Получить комикс по slug
+// @Description Получить детальную информацию о комиксе по slug (alternative_name)
+// @Tags Comics
+// @Produce json
+// @Param slug path string true "Slug комикса (alternative_name)"
+// @Success 200 {object} structur.Comics
+// @Failure 404 {object} map[string]interface{}
+// @Router /comics/{slug} [get]
+func GetComics(c *gin.Context) {
+	// Скрытые комиксы видны только тем, кто может ими управлять
+	comic, ok := findVisibleComics(c)
+	if !ok {
+		return
+	}
+
+	c.Header("ETag", comic.ETag())
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Get info successful", "data": comic})
+}
+
+// requireIfMatch извлекает версию комикса из заголовка If-Match.
+// Без заголовка отвечает 428, с некорректным значением - 412.
+func requireIfMatch(c *gin.Context) (uint, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"status": "failed", "message": "If-Match header with the comic ETag is required", "data": nil})
+		return 0, false
+	}
+
+	version, err := strconv.ParseUint(strings.Trim(strings.TrimPrefix(header, "W/"), `"`), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"status": "failed", "message": "Invalid If-Match header", "data": nil})
+		return 0, false
+	}
+	return uint(version), true
+}
+
+// versionMismatch отвечает 412 и сообщает актуальный ETag, если комикс удаётся прочитать
+func versionMismatch(c *gin.Context, slug string) {
+	if comic, err := structur.GetComicsBySlug(slug); err == nil {
+		c.Header("ETag", comic.ETag())
+	}
+	c.JSON(http.StatusPreconditionFailed, gin.H{"status": "failed", "message": structur.ErrVersionMismatch.Error(), "data": nil})
+}
+
 // DeleteComics godoc
 // @Summary Удалить комикс
-// @Description Удаление комикса
+// @Description Перемещение комикса в корзину. Главы и изображения удаляются окончательно по истечении срока хранения корзины. Требует If-Match с ETag комикса.
 // @Tags Comics
-// @Accept json
 // @Produce json
-// @Security Name  // Указывает, что требуется API ключ
-// @Param name query string true "Название комикса"  // Имя комикса передается через query параметр
-// @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]interface{}
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param If-Match header string true "ETag комикса"
+// @Param slug path string true "Slug комикса (alternative_name)"
+// @Success 200 {object} structur.Comics
 // @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
-// @Router /comics/delete [delete]
+// @Failure 412 {object} map[string]interface{}
+// @Failure 428 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /comics/{slug} [delete]
 func DeleteComics(c *gin.Context) {
-	// Извлекаем имя комикса через query параметр
-	comicName := c.DefaultQuery("name", "")
-	if comicName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Name parameter is missing", "data": nil})
+	version, ok := requireIfMatch(c)
+	if !ok {
 		return
 	}
 
-	// Проверяем, существует ли комикс в базе данных
-	comicInfo, err := structur.GetComicsInfo(comicName)
+	comicInfo, err := structur.DeleteComicBySlug(c.Param("slug"), version)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Comic not found", "data": nil})
+		} else if errors.Is(err, structur.ErrVersionMismatch) {
+			versionMismatch(c, c.Param("slug"))
 		} else {
-			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to delete comic", "data": nil})
 		}
 		return
 	}
 
-	// Удаляем комикс из базы данных
-	comicInfo, err = structur.DeleteComicByName(comicName)
+	// Формируем успешный ответ после удаления
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Comic moved to trash", "data": comicInfo})
+}
+
+// GetTrash godoc
+// @Summary Корзина комиксов
+// @Description Удалённые комиксы от недавно удалённых к старым с датой окончательного удаления
+// @Tags Comics
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param limit query int false "Количество комиксов (до 100)"
+// @Param offset query int false "Смещение"
+// @Success 200 {array} structur.TrashedComic
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /comics/trash [get]
+func GetTrash(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	comics, err := structur.GetTrashedComics(limit, offset)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to delete comic", "data": nil})
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": err.Error(), "data": nil})
 		return
 	}
 
-	// Формируем успешный ответ после удаления
-	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Comic deleted successfully", "data": comicInfo})
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Get trash successful", "data": comics})
+}
+
+// RestoreComics godoc
+// @Summary Восстановить комикс из корзины
+// @Description Возвращает удалённый комикс вместе с главами, пока он не удалён окончательно
+// @Tags Comics
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param slug path string true "Slug комикса (alternative_name)"
+// @Success 200 {object} structur.Comics
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /comics/{slug}/restore [post]
+func RestoreComics(c *gin.Context) {
+	comic, err := structur.RestoreComicBySlug(c.Param("slug"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Comic not found in trash", "data": nil})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to restore comic", "data": nil})
+		}
+		return
+	}
+
+	c.Header("ETag", comic.ETag())
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Comic restored successfully", "data": comic})
+}
+
+// validationFailed отвечает 400 со списком ошибок по полям
+func validationFailed(c *gin.Context, err *structur.ValidationError) {
+	c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Validation failed", "data": nil, "errors": err.Fields})
+}
+
+// duplicateRejected отвечает 409 со списком похожих загрузок
+func duplicateRejected(c *gin.Context, err *structur.DuplicateError) {
+	c.JSON(http.StatusConflict, gin.H{"status": "failed", "message": err.Error(), "data": nil, "duplicates": err.Duplicates})
+}
+
+// withDuplicatesNote дополняет сообщение об успехе предупреждением о похожих загрузках
+func withDuplicatesNote(message string, duplicates []structur.Duplicate) string {
+	if len(duplicates) == 0 {
+		return message
+	}
+	return message + ", but it looks like a duplicate of existing uploads"
+}
+
+// bindComicsUpdateForm собирает ComicsUpdate из multipart формы. Неизвестные поля считаются ошибкой.
+func bindComicsUpdateForm(c *gin.Context) (*structur.ComicsUpdate, error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+
+	var update structur.ComicsUpdate
+	var validation structur.ValidationError
+	for key, values := range form.Value {
+		value := ""
+		if len(values) > 0 {
+			value = values[0]
+		}
+
+		switch key {
+		case "name":
+			update.Name = &value
+		case "description":
+			update.Description = &value
+		case "author":
+			update.Author = &value
+		case "original_author":
+			update.Artist = &value
+		case "type_comics":
+			comicsType := structur.ComicsType(value)
+			update.Type = &comicsType
+		case "pegi":
+			pegi := structur.PegiType(value)
+			update.Pegi = &pegi
+		case "status":
+			status := structur.StatusType(value)
+			update.Status = &status
+		case "transfer_status":
+			status := structur.StatusType(value)
+			update.TransferStatus = &status
+		case "tags":
+			tags := values
+			update.Tags = &tags
+		case "genres":
+			genres := values
+			update.Genres = &genres
+		case "rating":
+			rating, err := strconv.ParseFloat(value, 32)
+			if err != nil {
+				validation.Fields = append(validation.Fields, structur.FieldError{Field: key, Message: "must be a number"})
+				continue
+			}
+			rating32 := float32(rating)
+			update.Rating = &rating32
+		case "year":
+			year, err := strconv.Atoi(value)
+			if err != nil {
+				validation.Fields = append(validation.Fields, structur.FieldError{Field: key, Message: "must be an integer"})
+				continue
+			}
+			update.Year = &year
+		case "is_finished", "hidden":
+			flag, err := strconv.ParseBool(value)
+			if err != nil {
+				validation.Fields = append(validation.Fields, structur.FieldError{Field: key, Message: "must be a boolean"})
+				continue
+			}
+			if key == "hidden" {
+				update.Hidden = &flag
+			} else {
+				update.IsFinished = &flag
+			}
+		case "image_path_upload", "banner_path_upload":
+			// Завершённые загрузки вместо файлов обложки и баннера, см. openOptionalFile
+		case "published_on":
+			publishedOn, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				validation.Fields = append(validation.Fields, structur.FieldError{Field: key, Message: "must be an RFC3339 date"})
+				continue
+			}
+			update.PublishedOn = &publishedOn
+		default:
+			validation.Fields = append(validation.Fields, structur.FieldError{Field: key, Message: "field cannot be updated"})
+		}
+	}
+
+	if len(validation.Fields) > 0 {
+		return nil, &validation
+	}
+	return &update, nil
+}
+
+// bindComicsUpdateJSON разбирает JSON тело. Неизвестные поля считаются ошибкой.
+func bindComicsUpdateJSON(c *gin.Context) (*structur.ComicsUpdate, error) {
+	var update structur.ComicsUpdate
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&update); err != nil {
+		// Сообщение encoding/json выглядит как: json: unknown field "views"
+		if field, found := strings.CutPrefix(err.Error(), "json: unknown field "); found {
+			return nil, &structur.ValidationError{Fields: []structur.FieldError{
+				{Field: strings.Trim(field, `"`), Message: "field cannot be updated"},
+			}}
+		}
+		return nil, err
+	}
+	return &update, nil
+}
+
+// openOptionalFile открывает файл или завершённую загрузку из формы, если они переданы
+func openOptionalFile(c *gin.Context, field string) (multipart.File, *structur.Upload, error) {
+	file, _, upload, err := openFormFile(c, field)
+	if errors.Is(err, http.ErrMissingFile) {
+		return nil, nil, nil
+	}
+	return file, upload, err
+}
+
+// UpdateComics godoc
+// @Summary Обновить комикс
+// @Description Частичное обновление комикса. Принимает JSON или multipart/form-data; в multipart можно заменить обложку (image_path) и баннер (banner_path).
+// @Description Вместо файлов можно передать ID завершённых загрузок в image_path_upload и banner_path_upload.
+// @Description Изменяются только переданные поля, неизвестные или нередактируемые поля отклоняются.
+// @Description Требует If-Match с ETag комикса; новый ETag возвращается в ответе.
+// @Description Новая обложка проверяется на сходство с обложками других комиксов, как при создании.
+// @Tags Comics
+// @Accept json
+// @Accept multipart/form-data
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param If-Match header string true "ETag комикса"
+// @Param slug path string true "Slug комикса (alternative_name)"
+// @Param comic body structur.ComicsUpdate false "Изменяемые поля (для JSON)"
+// @Success 200 {object} structur.Comics
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 412 {object} map[string]interface{}
+// @Failure 428 {object} map[string]interface{}
+// @Router /comics/{slug} [patch]
+func UpdateComics(c *gin.Context) {
+	version, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
+
+	var update *structur.ComicsUpdate
+	var cover, banner multipart.File
+	var coverUpload, bannerUpload *structur.Upload
+	var err error
+
+	if c.ContentType() == "multipart/form-data" {
+		update, err = bindComicsUpdateForm(c)
+		if err == nil {
+			cover, coverUpload, err = openOptionalFile(c, "image_path")
+		}
+		if err == nil {
+			banner, bannerUpload, err = openOptionalFile(c, "banner_path")
+		}
+	} else {
+		update, err = bindComicsUpdateJSON(c)
+	}
+	if cover != nil {
+		defer cover.Close()
+	}
+	if banner != nil {
+		defer banner.Close()
+	}
+
+	var validation *structur.ValidationError
+	if errors.As(err, &validation) {
+		validationFailed(c, validation)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+
+	// Интерфейсы io.Reader с nil внутри не равны nil, поэтому передаём их явно
+	var coverStream, bannerStream io.Reader
+	if cover != nil {
+		coverStream = cover
+	}
+	if banner != nil {
+		bannerStream = banner
+	}
+
+	comic, err := structur.UpdateComicsInfo(c.Param("slug"), version, update, coverStream, bannerStream, callerID(c))
+	if err != nil {
+		var duplicate *structur.DuplicateError
+		switch {
+		case errors.As(err, &validation):
+			validationFailed(c, validation)
+		case errors.As(err, &duplicate):
+			duplicateRejected(c, duplicate)
+		case errors.Is(err, structur.ErrVersionMismatch):
+			versionMismatch(c, c.Param("slug"))
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Comic not found", "data": nil})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		}
+		return
+	}
+
+	structur.RemoveUpload(coverUpload)
+	structur.RemoveUpload(bannerUpload)
+
+	c.Header("ETag", comic.ETag())
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": withDuplicatesNote("Comic updated successfully", comic.Duplicates), "data": comic})
 }
 
 // CreateComics godoc
 // @Summary Создать новый комикс
 // @Description Создание нового комикса с детальной информацией, включая изображение обложки и баннера.
+// @Description Если обложка похожа на обложку другого комикса, в ответе возвращаются duplicates, а при DUPLICATE_POLICY=reject комикс не создаётся (409).
 // @Tags Comics
 // @Accept multipart/form-data
 // @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
 // @Param name formData string true "Название комикса"
 // @Param alternative_name formData string true "Альтернативное название комикса"
 // @Param description formData string true "Описание комикса"
 // @Param rating formData float32 true "Рейтинг комикса"
-// @Param image_path formData file true "Изображение обложки комикса"
-// @Param banner_path formData file true "Изображение баннера комикса"
+// @Param image_path formData file false "Изображение обложки комикса: JPEG, PNG, GIF или WebP до 10 МБ, от 100x100 до 6000x9000"
+// @Param image_path_upload formData string false "ID завершённой загрузки (POST /uploads) вместо файла image_path"
+// @Param banner_path formData file false "Изображение баннера комикса: JPEG, PNG, GIF или WebP до 15 МБ, от 320x100 до 8000x6000"
+// @Param banner_path_upload formData string false "ID завершённой загрузки (POST /uploads) вместо файла banner_path"
 // @Param type_comics formData string true "Тип комикса"
 // @Param author formData string true "Автор комикса"
 // @Param original_author formData string true "Оригинальный автор комикса"
@@ -115,6 +465,9 @@ func DeleteComics(c *gin.Context) {
 // @Param bookmark formData int true "Закладки"
 // @Success 200 {object} structur.Comics
 // @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
 // @Router /comics/create [post]
 func CreateComics(c *gin.Context) {
 	var comic structur.Comics
@@ -153,40 +506,214 @@ func CreateComics(c *gin.Context) {
 	comic.Tags = pq.StringArray(c.PostFormArray("tags"))
 	comic.Genres = pq.StringArray(c.PostFormArray("genres"))
 
-	// Получение файлов изображения
-	coverFile, err := c.FormFile("image_path")
-	if err != nil {
+	// Открываем файлы изображения или завершённые загрузки для чтения
+	coverStream, _, coverUpload, err := openFormFile(c, "image_path")
+	if errors.Is(err, http.ErrMissingFile) {
 		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Cover image is required", "data": nil})
 		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Failed to open cover image: " + err.Error(), "data": nil})
+		return
 	}
-	bannerFile, err := c.FormFile("banner_path")
-	if err != nil {
+	defer coverStream.Close()
+
+	bannerStream, _, bannerUpload, err := openFormFile(c, "banner_path")
+	if errors.Is(err, http.ErrMissingFile) {
 		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Banner image is required", "data": nil})
 		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Failed to open banner image: " + err.Error(), "data": nil})
+		return
 	}
+	defer bannerStream.Close()
 
-	// Открываем файлы изображения для чтения
-	coverStream, err := coverFile.Open()
+	// Вызов функции UploadComics для сохранения комикса и изображений
+	comicResponse, err := structur.UploadComics(&comic, coverStream, bannerStream, callerID(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to open cover image", "data": nil})
+		var validation *structur.ValidationError
+		if errors.As(err, &validation) {
+			validationFailed(c, validation)
+			return
+		}
+		var duplicate *structur.DuplicateError
+		if errors.As(err, &duplicate) {
+			duplicateRejected(c, duplicate)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
 		return
 	}
-	defer coverStream.Close()
 
-	bannerStream, err := bannerFile.Open()
+	structur.RemoveUpload(coverUpload)
+	structur.RemoveUpload(bannerUpload)
+
+	// Ответ с успешным созданием комикса
+	c.Header("ETag", comicResponse.ETag())
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": withDuplicatesNote("Comic created successfully", comicResponse.Duplicates), "data": comicResponse})
+}
+
+// queryList собирает значения query параметра, переданные повторением или через запятую
+func queryList(c *gin.Context, key string) []string {
+	var values []string
+	for _, raw := range c.QueryArray(key) {
+		for _, value := range strings.Split(raw, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// callerID возвращает id пользователя, установленный AuthMiddleware, или 0 для анонимного запроса
+func callerID(c *gin.Context) uint {
+	userId, _ := strconv.ParseUint(c.GetString("userId"), 10, 64)
+	return uint(userId)
+}
+
+// callerCan проверяет право по роли, установленной AuthMiddleware или OptionalAuthMiddleware
+func callerCan(c *gin.Context, permission models.Permission) bool {
+	role, _ := c.Get("role")
+	userRole, _ := role.(models.Role)
+	return models.HasPermission(userRole, permission)
+}
+
+// ListComics godoc
+// @Summary Каталог комиксов
+// @Description Список комиксов с фильтрацией, сортировкой и курсорной пагинацией. Скрытые комиксы видны только модераторам и администраторам.
+// @Tags Comics
+// @Produce json
+// @Param type query []string false "Типы комиксов" collectionFormat(multi)
+// @Param status query []string false "Статусы" collectionFormat(multi)
+// @Param pegi query []string false "Возрастные рейтинги" collectionFormat(multi)
+// @Param year_from query int false "Год выпуска от"
+// @Param year_to query int false "Год выпуска до"
+// @Param is_finished query bool false "Завершён ли комикс"
+// @Param genres query []string false "Жанры, которые должны быть все" collectionFormat(multi)
+// @Param exclude_genres query []string false "Жанры, которых не должно быть" collectionFormat(multi)
+// @Param tags query []string false "Теги, которые должны быть все" collectionFormat(multi)
+// @Param exclude_tags query []string false "Теги, которых не должно быть" collectionFormat(multi)
+// @Param sort query string false "Сортировка" Enums(rating, views, likes, updated_at, published_on)
+// @Param order query string false "Направление сортировки" Enums(asc, desc)
+// @Param limit query int false "Размер страницы (до 100)"
+// @Param cursor query string false "Курсор следующей страницы из next_cursor"
+// @Success 200 {object} structur.CatalogPage
+// @Failure 400 {object} map[string]interface{}
+// @Router /comics [get]
+func ListComics(c *gin.Context) {
+	filter := structur.CatalogFilter{
+		Genres:        queryList(c, "genres"),
+		ExcludeGenres: queryList(c, "exclude_genres"),
+		Tags:          queryList(c, "tags"),
+		ExcludeTags:   queryList(c, "exclude_tags"),
+		Sort:          c.Query("sort"),
+		Ascending:     c.Query("order") == "asc",
+		Cursor:        c.Query("cursor"),
+		IncludeHidden: callerCan(c, models.PermComicsViewHidden),
+	}
+
+	for _, value := range queryList(c, "type") {
+		filter.Types = append(filter.Types, structur.ComicsType(value))
+	}
+	for _, value := range queryList(c, "status") {
+		filter.Statuses = append(filter.Statuses, structur.StatusType(value))
+	}
+	for _, value := range queryList(c, "pegi") {
+		filter.Pegi = append(filter.Pegi, structur.PegiType(value))
+	}
+
+	var err error
+	if value := c.Query("year_from"); value != "" {
+		if filter.YearFrom, err = strconv.Atoi(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid year_from", "data": nil})
+			return
+		}
+	}
+	if value := c.Query("year_to"); value != "" {
+		if filter.YearTo, err = strconv.Atoi(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid year_to", "data": nil})
+			return
+		}
+	}
+	if value := c.Query("is_finished"); value != "" {
+		isFinished, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid is_finished", "data": nil})
+			return
+		}
+		filter.IsFinished = &isFinished
+	}
+	if value := c.Query("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid limit", "data": nil})
+			return
+		}
+	}
+
+	page, err := structur.ListComics(filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to open banner image", "data": nil})
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
 		return
 	}
-	defer bannerStream.Close()
 
-	// Вызов функции UploadComics для сохранения комикса и изображений
-	comicResponse, err := structur.UploadComics(&comic, coverStream, bannerStream)
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Get comics successful", "data": page})
+}
+
+// SearchComics godoc
+// @Summary Поиск комиксов
+// @Description Полнотекстовый и нечёткий поиск по названию, альтернативному названию и описанию.
+// @Description Учитывает русский и английский стемминг, опечатки и транслитерацию.
+// @Tags Comics
+// @Produce json
+// @Param q query string true "Поисковый запрос"
+// @Param limit query int false "Количество результатов (до 50)"
+// @Param offset query int false "Смещение"
+// @Success 200 {array} structur.SearchResult
+// @Failure 400 {object} map[string]interface{}
+// @Router /comics/search [get]
+func SearchComics(c *gin.Context) {
+	text := c.Query("q")
+	if strings.TrimSpace(text) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Query parameter q is missing", "data": nil})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+
+	results, err := structur.SearchComics(text, limit, offset, callerCan(c, models.PermComicsViewHidden))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": err.Error(), "data": nil})
 		return
 	}
 
-	// Ответ с успешным созданием комикса
-	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Comic created successfully", "data": comicResponse})
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Search successful", "data": results})
+}
+
+// SuggestComics godoc
+// @Summary Автодополнение названий
+// @Description Подсказки названий комиксов по началу ввода с подсветкой совпадений тегом mark
+// @Tags Comics
+// @Produce json
+// @Param q query string true "Начало названия"
+// @Param limit query int false "Количество подсказок (до 20)"
+// @Success 200 {array} structur.Suggestion
+// @Failure 400 {object} map[string]interface{}
+// @Router /comics/suggest [get]
+func SuggestComics(c *gin.Context) {
+	text := c.Query("q")
+	if strings.TrimSpace(text) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Query parameter q is missing", "data": nil})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	suggestions, err := structur.SuggestComics(text, limit, callerCan(c, models.PermComicsViewHidden))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Suggest successful", "data": suggestions})
 }
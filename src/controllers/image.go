@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"main/src/imaging"
+	"main/src/models/structur"
+	"main/src/storage"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Изображения сохраняются под уникальными ключами и никогда не перезаписываются,
+// поэтому их можно кэшировать на год без повторной проверки
+const imageCacheControl = "public, max-age=31536000, immutable"
+
+// imageETag строит сильный ETag из ключа, размера и времени изменения объекта
+func imageETag(info storage.ObjectInfo) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d:%d", info.Key, info.Size, info.ModTime.UnixNano())))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// verifySignedURL проверяет подпись адреса страницы главы или архива главы и возвращает Cache-Control,
+// по которому ответ можно кэшировать не дольше срока действия адреса
+func verifySignedURL(c *gin.Context, key string) (string, bool) {
+	userID, err := storage.VerifySignature(key, c.Request.URL.Query())
+	if errors.Is(err, storage.ErrInvalidKey) {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Image not found", "data": nil})
+		return "", false
+	}
+	if errors.Is(err, storage.ErrSignatureExpired) {
+		c.JSON(http.StatusForbidden, gin.H{"status": "failed", "message": "Link has expired, reopen the chapter", "data": nil})
+		return "", false
+	}
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"status": "failed", "message": "Invalid link signature", "data": nil})
+		return "", false
+	}
+	if userID != 0 && userID != callerID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"status": "failed", "message": "Link belongs to another user", "data": nil})
+		return "", false
+	}
+
+	expires, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+	maxAge := strconv.FormatInt(expires-time.Now().Unix(), 10)
+	if userID != 0 {
+		return "private, max-age=" + maxAge, true
+	}
+	return "public, max-age=" + maxAge, true
+}
+
+// ServeImage godoc
+// @Summary Получить изображение
+// @Description Отдаёт обложку, баннер или страницу главы по ключу хранилища. Поддерживает If-None-Match, If-Modified-Since и Range.
+// @Description Формат (AVIF, WebP, JPEG) выбирается по заголовку Accept, ширина - по подсказке w. Недостающие варианты создаются при первом запросе.
+// @Description Без подписи отдаются только обложки и баннеры видимых комиксов. Страницы глав, изображения скрытых комиксов и комиксов в корзине - только по подписанным адресам
+// @Description из GET /comics/{slug}/chapters/{id}: без подписи, с чужой или истёкшей подписью - 403.
+// @Tags Images
+// @Produce image/jpeg,image/png,image/gif,image/webp,image/avif
+// @Param key path string true "Ключ изображения, например berserk/cover-1a2b3c4d5e6f7a8b.jpg"
+// @Param w query int false "Желаемая ширина, округляется вверх до 160, 320, 480, 640, 800, 960, 1280, 1600 или 1920"
+// @Param Accept header string false "Поддерживаемые форматы, например image/avif,image/webp"
+// @Param Range header string false "Диапазон байтов, например bytes=0-1023"
+// @Param expires query int false "Срок действия подписанного адреса страницы, Unix time"
+// @Param uid query int false "Пользователь, к которому привязан адрес страницы"
+// @Param sig query string false "Подпись адреса страницы"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Success 304 "Не изменилось"
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 416 "Диапазон вне файла"
+// @Router /images/{key} [get]
+func ServeImage(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+
+	// Временные файлы записи и другие служебные файлы хранилища не раздаются
+	cleaned, err := storage.CleanKey(key)
+	if err != nil || storage.IsHiddenKey(cleaned) {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Image not found", "data": nil})
+		return
+	}
+	key = cleaned
+
+	// Без подписи раздаются только обложки и баннеры. Страницы глав и всё остальное - только
+	// по подписанным адресам, чтобы каталог нельзя было обойти по предсказуемым ключам.
+	image, err := structur.LookupImage(key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to open image", "data": nil})
+		return
+	}
+	cacheControl := imageCacheControl
+	if !image.Public {
+		var ok bool
+		if cacheControl, ok = verifySignedURL(c, key); !ok {
+			return
+		}
+	}
+
+	// Выбор варианта по Accept и подсказке ширины ?w=
+	if imaging.Negotiable(key) {
+		c.Header("Vary", "Accept")
+		if width, format, ok := imaging.Negotiate(key, c.GetHeader("Accept"), c.Query("w")); ok {
+			// Сначала подходящий вариант из сохранённых при загрузке (thumbnail, card, full),
+			// иначе вариант строится по ширине ?w=
+			if stored, ok := image.Variants.Fit(width, format); width > 0 && ok {
+				key = imaging.VariantKey(key, stored.Name, stored.Format)
+			} else if variant, err := imaging.Derive(key, width, format); err == nil {
+				key = variant
+			} else if !errors.Is(err, storage.ErrNotFound) && !errors.Is(err, storage.ErrInvalidKey) {
+				// Если вариант построить не удалось, отдаём оригинал
+				log.Printf("Failed to derive %s variant of %s: %v", format, key, err)
+			}
+		}
+	}
+
+	object, err := storage.Default.Open(key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+			c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Image not found", "data": nil})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to open image", "data": nil})
+		}
+		return
+	}
+	defer object.Close()
+
+	info, err := object.Stat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to read image", "data": nil})
+		return
+	}
+
+	c.Header("ETag", imageETag(info))
+	c.Header("Cache-Control", cacheControl)
+	c.Header("Content-Type", info.ContentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	// ServeContent сам обрабатывает условные запросы и Range
+	http.ServeContent(c.Writer, c.Request, path.Base(key), info.ModTime, object)
+}
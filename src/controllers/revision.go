@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"errors"
+	"main/src/models/structur"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetComicRevisions godoc
+// @Summary История изменений комикса
+// @Description Ревизии метаданных комикса от новых к старым: кто, когда и какие поля изменил
+// @Tags Revisions
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param slug path string true "Slug комикса (alternative_name)"
+// @Param limit query int false "Количество ревизий (до 100)"
+// @Param offset query int false "Смещение"
+// @Success 200 {array} structur.ComicRevision
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /comics/{slug}/revisions [get]
+func GetComicRevisions(c *gin.Context) {
+	comic, ok := findComicsBySlug(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	revisions, err := structur.GetComicRevisions(comic.ID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Get revisions successful", "data": revisions})
+}
+
+// RestoreComicRevision godoc
+// @Summary Восстановить ревизию комикса
+// @Description Вернуть метаданные комикса к состоянию указанной ревизии. Восстановление записывается новой ревизией.
+// @Tags Revisions
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param slug path string true "Slug комикса (alternative_name)"
+// @Param id path int true "ID ревизии"
+// @Success 200 {object} structur.Comics
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /comics/{slug}/revisions/{id}/restore [post]
+func RestoreComicRevision(c *gin.Context) {
+	revisionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid revision id", "data": nil})
+		return
+	}
+
+	comic, err := structur.RestoreComicRevision(c.Param("slug"), uint(revisionID), callerID(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		case errors.Is(err, structur.ErrVersionMismatch):
+			c.JSON(http.StatusConflict, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		}
+		return
+	}
+
+	c.Header("ETag", comic.ETag())
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Revision restored successfully", "data": comic})
+}
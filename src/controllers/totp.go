@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"main/src/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TOTPCodeDTO struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type LoginChallengeDTO struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// totpFailed отвечает на ошибку проверки 2FA
+func totpFailed(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrTOTPInvalidCode), errors.Is(err, models.ErrLoginChallengeFailed):
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+	case errors.Is(err, models.ErrTOTPLocked):
+		c.JSON(http.StatusTooManyRequests, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+	case errors.Is(err, models.ErrTOTPEnabled), errors.Is(err, models.ErrTOTPNotEnabled), errors.Is(err, models.ErrTOTPNotSetUp):
+		c.JSON(http.StatusConflict, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+	default:
+		log.Printf("Two-factor authentication failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Two-factor authentication failed", "data": nil})
+	}
+}
+
+// currentUser загружает пользователя, установленного AuthMiddleware
+func currentUser(c *gin.Context) (*models.User, bool) {
+	user, err := models.FetchUser(callerID(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "User not found", "data": nil})
+		return nil, false
+	}
+	return user, true
+}
+
+// SetupTOTP godoc
+// @Summary Начать настройку 2FA
+// @Description Создаёт секрет TOTP и otpauth URI для приложения-аутентификатора (QR код строится на клиенте).
+// @Description 2FA включается после подтверждения кодом в POST /auth/2fa/enable.
+// @Tags 2FA
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Success 200 {object} models.TOTPSetup
+// @Failure 401 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /auth/2fa/setup [post]
+func SetupTOTP(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	setup, err := models.SetupTOTP(user)
+	if err != nil {
+		totpFailed(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Scan the URI with an authenticator app and confirm with a code", "data": setup})
+}
+
+// EnableTOTP godoc
+// @Summary Включить 2FA
+// @Description Включает 2FA, если код из приложения верный, и завершает все остальные сессии пользователя.
+// @Description Возвращает коды восстановления: они показываются один раз.
+// @Tags 2FA
+// @Accept json
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param code body TOTPCodeDTO true "Код из приложения"
+// @Success 200 {array} string
+// @Failure 401 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Router /auth/2fa/enable [post]
+func EnableTOTP(c *gin.Context) {
+	var input TOTPCodeDTO
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	codes, err := models.EnableTOTP(user, input.Code, c.GetString("sessionId"))
+	if err != nil {
+		totpFailed(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Two-factor authentication enabled, store the recovery codes", "data": codes})
+}
+
+// DisableTOTP godoc
+// @Summary Выключить 2FA
+// @Description Выключает 2FA по коду из приложения или коду восстановления
+// @Tags 2FA
+// @Accept json
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param code body TOTPCodeDTO true "Код из приложения или код восстановления"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Router /auth/2fa/disable [post]
+func DisableTOTP(c *gin.Context) {
+	var input TOTPCodeDTO
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DisableTOTP(user, input.Code); err != nil {
+		totpFailed(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Two-factor authentication disabled", "data": nil})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Новые коды восстановления
+// @Description Выдаёт новые коды восстановления, прежние перестают действовать. Нужен код из приложения.
+// @Tags 2FA
+// @Accept json
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param code body TOTPCodeDTO true "Код из приложения"
+// @Success 200 {array} string
+// @Failure 401 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Router /auth/2fa/recovery-codes [post]
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var input TOTPCodeDTO
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	codes, err := models.RegenerateRecoveryCodes(user, input.Code)
+	if err != nil {
+		totpFailed(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Recovery codes regenerated", "data": codes})
+}
+
+// VerifyLoginChallenge godoc
+// @Summary Второй шаг входа
+// @Description Обменивает challenge_token из POST /auth/login и код из приложения или код восстановления на токены.
+// @Description challenge_token действует 5 минут и обменивается на токены один раз; после 5 неверных кодов подряд проверка блокируется на 15 минут, а challenge_token отменяется.
+// @Tags 2FA
+// @Accept json
+// @Produce json
+// @Param challenge body LoginChallengeDTO true "Токен второго шага и код"
+// @Success 200 {object} models.AuthResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Router /auth/2fa/verify [post]
+func VerifyLoginChallenge(c *gin.Context) {
+	var input LoginChallengeDTO
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+
+	authResponse, err := models.CompleteLoginChallenge(input.ChallengeToken, input.Code, sessionClient(c))
+	if err != nil {
+		totpFailed(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Login successful", "data": authResponse})
+}
@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"main/src/models/structur"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Поддерживаемая версия протокола tus и его расширения
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,creation-with-upload,termination,expiration"
+	tusChunkType  = "application/offset+octet-stream"
+)
+
+// tusResumable добавляет обязательный заголовок Tus-Resumable и проверяет версию протокола клиента
+func tusResumable(c *gin.Context) bool {
+	c.Header("Tus-Resumable", tusVersion)
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"status": "failed", "message": "Unsupported tus version, expected " + tusVersion, "data": nil})
+		return false
+	}
+	return true
+}
+
+// uploadHeaders выставляет смещение и срок хранения загрузки
+func uploadHeaders(c *gin.Context, upload *structur.Upload) {
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+}
+
+// uploadFailed отвечает на ошибку загрузки статусом, который ожидают клиенты tus
+func uploadFailed(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, structur.ErrUploadExpired):
+		status = http.StatusGone
+	case errors.Is(err, structur.ErrUploadOffsetMismatch):
+		status = http.StatusConflict
+	case errors.Is(err, structur.ErrUploadLocked):
+		status = http.StatusLocked
+	case errors.Is(err, structur.ErrUploadTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, structur.ErrUploadQuotaExceeded):
+		status = http.StatusTooManyRequests
+	}
+	if status == http.StatusInternalServerError {
+		log.Printf("Upload failed: %v", err)
+	}
+	c.AbortWithStatusJSON(status, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+}
+
+// UploadOptions godoc
+// @Summary Возможности сервера загрузок
+// @Description Версия протокола tus, поддерживаемые расширения и максимальный размер загрузки
+// @Tags Uploads
+// @Success 204 "Tus-Version, Tus-Extension и Tus-Max-Size в заголовках"
+// @Router /uploads [options]
+func UploadOptions(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(structur.UploadMaxSize(), 10))
+	c.Status(http.StatusNoContent)
+}
+
+// CreateUpload godoc
+// @Summary Начать загрузку
+// @Description Создаёт загрузку по протоколу tus 1.0.0. Адрес загрузки возвращается в заголовке Location.
+// @Description Завершённая загрузка передаётся вместо файла: image_path_upload и banner_path_upload при создании и изменении комикса, archive_upload при импорте главы.
+// @Description Незавершённые и неиспользованные загрузки удаляются через UPLOAD_EXPIRY после последнего куска.
+// @Tags Uploads
+// @Accept application/offset+octet-stream
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param Tus-Resumable header string true "Версия протокола, 1.0.0"
+// @Param Upload-Length header int true "Размер файла в байтах"
+// @Param Upload-Metadata header string false "Пары 'ключ base64(значение)' через запятую, например filename и filetype"
+// @Success 201 {object} structur.Upload
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 412 {object} map[string]interface{}
+// @Failure 413 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{} "Превышено число активных загрузок или их суммарный размер"
+// @Router /uploads [post]
+func CreateUpload(c *gin.Context) {
+	if !tusResumable(c) {
+		return
+	}
+	if c.GetHeader("Upload-Defer-Length") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Upload-Defer-Length is not supported", "data": nil})
+		return
+	}
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Upload-Length header is required", "data": nil})
+		return
+	}
+
+	upload, err := structur.CreateUpload(callerID(c), length, c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		if errors.Is(err, structur.ErrUploadTooLarge) || errors.Is(err, structur.ErrUploadQuotaExceeded) {
+			uploadFailed(c, err)
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		}
+		return
+	}
+
+	// Расширение creation-with-upload: первый кусок может прийти вместе с созданием
+	if c.ContentType() == tusChunkType && c.Request.ContentLength != 0 {
+		if written, err := structur.WriteUpload(upload.ID, upload.UserID, 0, c.Request.Body); err == nil {
+			upload = written
+		} else {
+			log.Printf("Failed to write first chunk of upload %s: %v", upload.ID, err)
+		}
+	}
+
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.ID)
+	uploadHeaders(c, upload)
+	c.JSON(http.StatusCreated, gin.H{"status": "success", "message": "Upload created successfully", "data": upload})
+}
+
+// GetUploadOffset godoc
+// @Summary Состояние загрузки
+// @Description Сколько байт уже получено. Клиент продолжает загрузку с Upload-Offset.
+// @Tags Uploads
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param Tus-Resumable header string true "Версия протокола, 1.0.0"
+// @Param id path string true "ID загрузки"
+// @Success 200 "Upload-Offset, Upload-Length и Upload-Expires в заголовках"
+// @Failure 404 "Загрузка не найдена"
+// @Failure 410 "Срок хранения загрузки истёк"
+// @Router /uploads/{id} [head]
+func GetUploadOffset(c *gin.Context) {
+	if !tusResumable(c) {
+		return
+	}
+
+	upload, err := structur.GetUpload(c.Param("id"), callerID(c))
+	if err != nil {
+		uploadFailed(c, err)
+		return
+	}
+
+	uploadHeaders(c, upload)
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		c.Header("Upload-Metadata", upload.Metadata)
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+}
+
+// WriteUpload godoc
+// @Summary Передать кусок загрузки
+// @Description Дописывает тело запроса к загрузке. Upload-Offset должен совпадать с уже полученным числом байт.
+// @Description Если соединение оборвалось, полученная часть сохраняется; текущее смещение можно узнать запросом HEAD.
+// @Tags Uploads
+// @Accept application/offset+octet-stream
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param Tus-Resumable header string true "Версия протокола, 1.0.0"
+// @Param Upload-Offset header int true "Смещение куска"
+// @Param id path string true "ID загрузки"
+// @Success 204 "Новое Upload-Offset в заголовке"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 410 {object} map[string]interface{}
+// @Failure 415 {object} map[string]interface{}
+// @Failure 423 {object} map[string]interface{}
+// @Router /uploads/{id} [patch]
+func WriteUpload(c *gin.Context) {
+	if !tusResumable(c) {
+		return
+	}
+	if c.ContentType() != tusChunkType {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"status": "failed", "message": "Content-Type must be " + tusChunkType, "data": nil})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Upload-Offset header is required", "data": nil})
+		return
+	}
+
+	upload, err := structur.WriteUpload(c.Param("id"), callerID(c), offset, c.Request.Body)
+	if upload != nil {
+		uploadHeaders(c, upload)
+	}
+	if err != nil {
+		if upload != nil && !errors.Is(err, structur.ErrUploadOffsetMismatch) {
+			// Полученная часть сохранена, клиент продолжит с нового смещения
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Failed to read upload chunk: " + err.Error(), "data": nil})
+			return
+		}
+		uploadFailed(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteUpload godoc
+// @Summary Отменить загрузку
+// @Description Удаляет загрузку вместе с полученными данными (расширение termination)
+// @Tags Uploads
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param Tus-Resumable header string true "Версия протокола, 1.0.0"
+// @Param id path string true "ID загрузки"
+// @Success 204 "Загрузка удалена"
+// @Failure 404 {object} map[string]interface{}
+// @Failure 423 {object} map[string]interface{}
+// @Router /uploads/{id} [delete]
+func DeleteUpload(c *gin.Context) {
+	if !tusResumable(c) {
+		return
+	}
+
+	if err := structur.DeleteUpload(c.Param("id"), callerID(c)); err != nil {
+		uploadFailed(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// openFormFile открывает файл из поля field формы или завершённую загрузку,
+// id которой передан в поле field+"_upload". Если нет ни того, ни другого, возвращает http.ErrMissingFile.
+// Использованную загрузку нужно удалить через structur.RemoveUpload после успешной обработки.
+func openFormFile(c *gin.Context, field string) (multipart.File, int64, *structur.Upload, error) {
+	if id := c.PostForm(field + "_upload"); id != "" {
+		upload, file, err := structur.OpenCompletedUpload(id, callerID(c))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				err = errors.New("upload not found")
+			}
+			return nil, 0, nil, errors.New(field + "_upload: " + err.Error())
+		}
+		return file, upload.Length, upload, nil
+	}
+
+	header, err := c.FormFile(field)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return file, header.Size, nil, nil
+}
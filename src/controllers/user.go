@@ -1,20 +1,47 @@
 package controllers
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"log"
 	"main/src/models"
 	"net/http"
 	"strings"
 )
 
+type RefreshDTO struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type TokenDTO struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ForgotPasswordDTO struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ResetPasswordDTO struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+// sessionClient описывает устройство, с которого пришёл запрос
+func sessionClient(c *gin.Context) models.SessionClient {
+	return models.NewSessionClient(c.Request.UserAgent(), c.ClientIP())
+}
+
 // Login godoc
 // @Summary Логин пользователя
-// @Description Логин с использованием email и пароля
+// @Description Логин с использованием email и пароля. Возвращает access токен (token, действует ACCESS_TOKEN_TTL) и refresh токен для POST /auth/refresh.
+// @Description Если у пользователя включена 2FA, вместо токенов возвращается challenge_token, который вместе с кодом передаётся в POST /auth/2fa/verify.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param user body models.User true "Данные для входа"
 // @Success 200 {object} models.AuthResponse
+// @Success 200 {object} models.LoginChallenge
 // @Failure 400 {object} map[string]interface{}
 // @Router /auth/login [post]
 func Login(c *gin.Context) {
@@ -24,15 +51,252 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	authResponse, err := input.Login()
+	authResponse, challenge, err := input.Login(sessionClient(c))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
 		return
 	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Two-factor code required", "data": challenge})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Login successful", "data": authResponse})
 }
 
+// Refresh godoc
+// @Summary Обновить токены
+// @Description Обменивает refresh токен на новый access токен и новый refresh токен. Каждый refresh токен одноразовый:
+// @Description повторное предъявление уже обменянного токена считается кражей и завершает вход на всех устройствах, где он продолжен.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param token body RefreshDTO true "Refresh токен"
+// @Success 200 {object} models.AuthResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /auth/refresh [post]
+func Refresh(c *gin.Context) {
+	var input RefreshDTO
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+
+	authResponse, err := models.RefreshTokens(input.RefreshToken, sessionClient(c))
+	if err != nil {
+		if errors.Is(err, models.ErrRefreshTokenInvalid) || errors.Is(err, models.ErrRefreshTokenReused) || errors.Is(err, models.ErrTokenRevoked) ||
+			errors.Is(err, models.ErrSessionExpired) {
+			c.JSON(http.StatusUnauthorized, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		} else {
+			log.Printf("Failed to refresh tokens: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to refresh tokens", "data": nil})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Tokens refreshed successfully", "data": authResponse})
+}
+
+// Logout godoc
+// @Summary Выход
+// @Description Завершает текущий вход: refresh токен больше не обменивается, а access токен перестаёт приниматься сразу, не дожидаясь истечения
+// @Tags users
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /auth/logout [post]
+func Logout(c *gin.Context) {
+	if err := models.RevokeTokenFamily(c.GetString("sessionId")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Logged out successfully", "data": nil})
+}
+
+// GetSessions godoc
+// @Summary Активные сессии
+// @Description Устройства, на которых выполнен вход: браузер и система, IP и время последнего запроса. Текущая сессия отмечена current.
+// @Tags users
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Success 200 {array} models.TokenFamily
+// @Failure 401 {object} map[string]interface{}
+// @Router /auth/sessions [get]
+func GetSessions(c *gin.Context) {
+	sessions, err := models.GetSessions(callerID(c), c.GetString("sessionId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Get sessions successful", "data": sessions})
+}
+
+// RevokeSession godoc
+// @Summary Завершить сессию
+// @Description Выход на другом устройстве: refresh токен сессии больше не обменивается, а её access токены сразу перестают приниматься
+// @Tags users
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Param id path string true "ID сессии"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /auth/sessions/{id} [delete]
+func RevokeSession(c *gin.Context) {
+	if err := models.RevokeSession(callerID(c), c.Param("id")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Session not found", "data": nil})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Session revoked successfully", "data": nil})
+}
+
+// VerifyEmail godoc
+// @Summary Подтвердить email
+// @Description Подтверждение email по токену из письма, которое отправляется при регистрации. Токен одноразовый и действует EMAIL_VERIFICATION_TTL.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param token body TokenDTO true "Токен из ссылки в письме"
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} map[string]interface{}
+// @Router /auth/verify-email [post]
+func VerifyEmail(c *gin.Context) {
+	var input TokenDTO
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+
+	user, err := models.VerifyEmail(input.Token)
+	if err != nil {
+		if errors.Is(err, models.ErrAccountTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Email verified successfully", "data": user.Response()})
+}
+
+// ResendVerification godoc
+// @Summary Повторить письмо подтверждения
+// @Description Отправляет новое письмо для подтверждения email. Ссылки из прежних писем перестают действовать.
+// @Tags users
+// @Produce json
+// @Security apiKey
+// @Param Authorization header string true "API Key in Bearer format"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Router /auth/verify-email/resend [post]
+func ResendVerification(c *gin.Context) {
+	user, err := models.FetchUser(callerID(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "User not found", "data": nil})
+		return
+	}
+
+	if err := models.SendEmailVerification(user); err != nil {
+		switch {
+		case errors.Is(err, models.ErrEmailVerified):
+			c.JSON(http.StatusConflict, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		case errors.Is(err, models.ErrAccountMailTooOften):
+			c.JSON(http.StatusTooManyRequests, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		default:
+			log.Printf("Failed to send verification mail to user %d: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to send verification email", "data": nil})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Verification email sent", "data": nil})
+}
+
+// ForgotPassword godoc
+// @Summary Запросить сброс пароля
+// @Description Отправляет на email ссылку для сброса пароля, действующую PASSWORD_RESET_TTL.
+// @Description Ответ одинаковый, зарегистрирован адрес или нет.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param email body ForgotPasswordDTO true "Email пользователя"
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /auth/password/forgot [post]
+func ForgotPassword(c *gin.Context) {
+	var input ForgotPasswordDTO
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+
+	// Письмо отправляется в фоне, чтобы по времени ответа нельзя было узнать, есть ли такой пользователь
+	go func(email string) {
+		if err := models.RequestPasswordReset(email); err != nil && !errors.Is(err, models.ErrAccountMailTooOften) {
+			log.Printf("Failed to send password reset mail: %v", err)
+		}
+	}(input.Email)
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "If the email is registered, a password reset link has been sent", "data": nil})
+}
+
+// ResetPassword godoc
+// @Summary Сбросить пароль
+// @Description Задаёт новый пароль по токену из письма. Токен одноразовый; все сессии пользователя завершаются.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param password body ResetPasswordDTO true "Токен из ссылки в письме и новый пароль, не короче 8 символов"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /auth/password/reset [post]
+func ResetPassword(c *gin.Context) {
+	var input ResetPasswordDTO
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		return
+	}
+
+	if err := models.ResetPassword(input.Token, input.Password); err != nil {
+		if errors.Is(err, models.ErrAccountTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": err.Error(), "data": nil})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Password has been reset, please log in again", "data": nil})
+}
+
+// GetJWKS godoc
+// @Summary Открытые ключи JWT
+// @Description Набор JWK для проверки access токенов другими сервисами: текущий ключ подписи и прежние ключи из JWT_VERIFICATION_KEYS.
+// @Description Ключ выбирается по kid из заголовка токена. При подписи секретом HS256 набор пуст.
+// @Tags users
+// @Produce json
+// @Success 200 {object} models.JWKSet
+// @Router /.well-known/jwks.json [get]
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, models.PublicKeys())
+}
+
 // Register godoc
 // @Summary Регистрация пользователя
 // @Description Регистрация нового пользователя с использованием JSON данных
@@ -51,7 +315,7 @@ func Register(c *gin.Context) {
 	}
 
 	// Вызов метода Register из модели для регистрации пользователя
-	authResponse, err := input.Register()
+	authResponse, err := input.Register(sessionClient(c))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "data": nil})
 		return
@@ -69,7 +333,7 @@ func Register(c *gin.Context) {
 // @Produce json
 // @Security apiKey  // Указывает, что требуется API ключ
 // @Param Authorization header string true "API Key in Bearer format"  // Указываем, что ключ передается в заголовке в формате Bearer
-// @Success 200 {object} models.User
+// @Success 200 {object} models.UserResponse
 // @Failure 400 {object} map[string]interface{}
 // @Failure 401 {object} map[string]interface{}
 // @Router /auth/profile [get]
@@ -91,7 +355,7 @@ func GetProfile(c *gin.Context) {
 	reqToken := token[len("Bearer "):]
 
 	// Декодируем и проверяем токен
-	claims, err := models.DecodeToken(reqToken)
+	claims, err := models.AuthenticateToken(reqToken)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"status": "failed", "message": "Invalid token: " + err.Error(), "data": nil})
 		return
@@ -105,12 +369,6 @@ func GetProfile(c *gin.Context) {
 		return
 	}
 
-	// Формируем ответ с данными пользователя
-	authResponse := models.AuthResponse{
-		User:  &user,
-		Token: reqToken, // При необходимости добавляем токен в ответ
-	}
-
-	// Возвращаем успешный ответ с данными пользователя
-	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "User profile fetched successfully", "data": authResponse})
+	// Возвращаем данные пользователя без хэша пароля и секретов 2FA
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "User profile fetched successfully", "data": user.Response()})
 }
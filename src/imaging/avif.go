@@ -0,0 +1,74 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+// ErrAVIFUnavailable - в системе нет кодировщика avifenc (пакет libavif-bin)
+var ErrAVIFUnavailable = errors.New("avifenc is not installed")
+
+var (
+	avifencOnce sync.Once
+	avifencPath string
+)
+
+// AVIFAvailable сообщает, можно ли кодировать AVIF. Чистого Go кодировщика AVIF нет,
+// поэтому используется avifenc из libavif, если он установлен.
+func AVIFAvailable() bool {
+	avifencOnce.Do(func() {
+		avifencPath, _ = exec.LookPath("avifenc")
+	})
+	return avifencPath != ""
+}
+
+// encodeAVIF кодирует изображение через avifenc, передавая его во временном PNG файле
+func encodeAVIF(w io.Writer, img image.Image) error {
+	if !AVIFAvailable() {
+		return ErrAVIFUnavailable
+	}
+
+	dir, err := os.MkdirTemp("", "avif-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input.png")
+	output := filepath.Join(dir, "output.avif")
+
+	file, err := os.Create(input)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	// --min/--max понимают и старые (0.x), и новые версии avifenc
+	cmd := exec.Command(avifencPath, "--speed", "8", "--min", "20", "--max", "40", "--jobs", "1", input, output)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.New("avifenc: " + err.Error() + ": " + stderr.String())
+	}
+
+	encoded, err := os.Open(output)
+	if err != nil {
+		return err
+	}
+	defer encoded.Close()
+	_, err = io.Copy(w, encoded)
+	return err
+}
@@ -0,0 +1,96 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"main/src/storage"
+	"main/src/utils"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Максимальный размер исходного файла, из которого строится вариант
+const maxSourceSize = 50 << 20
+
+// ErrBusy - все обработчики заняты, вариант не удалось построить за отведённое время
+var ErrBusy = errors.New("image workers are busy")
+
+var (
+	workersOnce sync.Once
+	workers     chan struct{}
+	workerWait  time.Duration
+	inflight    singleflight.Group
+)
+
+// initWorkers читает настройки пула: IMAGE_WORKERS - число одновременных кодировщиков
+// (по умолчанию число CPU), IMAGE_WORKER_WAIT - сколько запрос ждёт свободного обработчика
+func initWorkers() {
+	count := runtime.NumCPU()
+	if value, err := strconv.Atoi(utils.GetEnv("IMAGE_WORKERS", "")); err == nil && value > 0 {
+		count = value
+	}
+	workers = make(chan struct{}, count)
+	workerWait = utils.GetDurationEnv("IMAGE_WORKER_WAIT", 10*time.Second)
+}
+
+// Derive возвращает ключ варианта объекта source с шириной width в формате format.
+// Если варианта ещё нет, он строится в ограниченном пуле обработчиков и сохраняется в хранилище.
+// Одновременные запросы одного и того же варианта ждут одной и той же сборки.
+func Derive(source string, width int, format Format) (string, error) {
+	key := VariantKey(source, variantName(width), format)
+	if _, err := storage.Default.Stat(key); err == nil {
+		return key, nil
+	}
+
+	workersOnce.Do(initWorkers)
+	_, err, _ := inflight.Do(key, func() (interface{}, error) {
+		select {
+		case workers <- struct{}{}:
+			defer func() { <-workers }()
+		case <-time.After(workerWait):
+			return nil, ErrBusy
+		}
+
+		// Пока ждали обработчик, вариант мог собрать другой экземпляр приложения
+		if _, err := storage.Default.Stat(key); err == nil {
+			return nil, nil
+		}
+		return nil, render(source, key, width, format)
+	})
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func render(source, key string, width int, format Format) error {
+	object, err := storage.Default.Open(source)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(io.LimitReader(object, maxSourceSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxSourceSize {
+		return fmt.Errorf("source image %s is too large", source)
+	}
+
+	img, err := Decode(data)
+	if err != nil {
+		return err
+	}
+	encoded, _, err := Render(img, width, format)
+	if err != nil {
+		return err
+	}
+	return storage.Default.Put(key, bytes.NewReader(encoded), int64(len(encoded)), storage.ContentType(key))
+}
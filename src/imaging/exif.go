@@ -0,0 +1,114 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+// jpegOrientation читает тег Orientation (0x0112) из EXIF блока JPEG.
+// Возвращает 1 (без поворота), если тега нет или файл не JPEG.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	offset := 2
+	for offset+4 <= len(data) {
+		if data[offset] != 0xFF {
+			return 1
+		}
+		marker := data[offset+1]
+		// SOS: дальше идут данные изображения, EXIF уже не встретится
+		if marker == 0xDA {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		if length < 2 || offset+2+length > len(data) {
+			return 1
+		}
+		segment := data[offset+4 : offset+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		offset += 2 + length
+	}
+	return 1
+}
+
+// tiffOrientation ищет тег Orientation в IFD0 TIFF заголовка EXIF
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
+
+// applyOrientation поворачивает и отражает изображение так,
+// чтобы оно выглядело правильно без тега Orientation
+func applyOrientation(src image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	// Ориентации 5-8 меняют ширину и высоту местами
+	if orientation >= 5 {
+		width, height = height, width
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Отражение по горизонтали
+				dx, dy = bounds.Dx()-1-x, y
+			case 3: // Поворот на 180°
+				dx, dy = bounds.Dx()-1-x, bounds.Dy()-1-y
+			case 4: // Отражение по вертикали
+				dx, dy = x, bounds.Dy()-1-y
+			case 5: // Транспонирование
+				dx, dy = y, x
+			case 6: // Поворот на 90° по часовой
+				dx, dy = bounds.Dy()-1-y, x
+			case 7: // Поперечное отражение
+				dx, dy = bounds.Dy()-1-y, bounds.Dx()-1-x
+			case 8: // Поворот на 90° против часовой
+				dx, dy = y, bounds.Dx()-1-x
+			}
+			dst.Set(dx, dy, src.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return dst
+}
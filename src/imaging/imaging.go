@@ -0,0 +1,213 @@
+package imaging
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/chai2010/webp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+type Format string
+
+const (
+	JPEG Format = "jpeg"
+	PNG  Format = "png"
+	WebP Format = "webp"
+	AVIF Format = "avif"
+)
+
+const (
+	jpegQuality = 85
+	webpQuality = 80
+)
+
+// Size - именованная ширина варианта изображения
+type Size struct {
+	Name  string
+	Width int
+}
+
+// Размеры вариантов обложки: миниатюра для поиска, карточка каталога и полноразмерная
+var CoverSizes = []Size{
+	{Name: "thumbnail", Width: 160},
+	{Name: "card", Width: 320},
+	{Name: "full", Width: 800},
+}
+
+// Размеры вариантов баннера
+var BannerSizes = []Size{
+	{Name: "thumbnail", Width: 480},
+	{Name: "card", Width: 960},
+	{Name: "full", Width: 1920},
+}
+
+// Форматы, в которых сохраняется каждый вариант. WebP идёт первым как предпочтительный.
+var VariantFormats = []Format{WebP, JPEG}
+
+// Variant - сохранённый вариант изображения
+type Variant struct {
+	Name   string `json:"name"`
+	Format Format `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Size   int64  `json:"size"`
+	URL    string `json:"url,omitempty"` // Заполняется при чтении из базы
+}
+
+// Variants хранится в базе как jsonb
+type Variants []Variant
+
+func (variants Variants) Value() (driver.Value, error) {
+	// Адреса зависят от настроек раздачи, поэтому в базу не попадают
+	stored := make(Variants, len(variants))
+	for i, variant := range variants {
+		variant.URL = ""
+		stored[i] = variant
+	}
+	data, err := json.Marshal(stored)
+	return string(data), err
+}
+
+func (variants *Variants) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case nil:
+		*variants = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(data, variants)
+	case string:
+		return json.Unmarshal([]byte(data), variants)
+	}
+	return fmt.Errorf("cannot scan %T into Variants", value)
+}
+
+// Fit возвращает самый узкий сохранённый вариант в формате format шириной не меньше width
+func (variants Variants) Fit(width int, format Format) (Variant, bool) {
+	var best Variant
+	found := false
+	for _, variant := range variants {
+		if variant.Format != format || variant.Width < width {
+			continue
+		}
+		if !found || variant.Width < best.Width {
+			best, found = variant, true
+		}
+	}
+	return best, found
+}
+
+// ErrUnsupportedFormat - данные не являются изображением поддерживаемого формата
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+// Decode декодирует изображение и поворачивает его согласно EXIF Orientation.
+// Метаданные в результат не попадают, поэтому при повторном кодировании EXIF удаляется.
+func Decode(data []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return nil, ErrUnsupportedFormat
+		}
+		return nil, err
+	}
+	return applyOrientation(img, jpegOrientation(data)), nil
+}
+
+// IsOpaque сообщает, что в изображении нет прозрачных пикселей
+func IsOpaque(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return opaque.Opaque()
+	}
+	return false
+}
+
+// SourceFormat - формат для хранения оригинала: PNG сохраняет прозрачность, остальное в JPEG
+func SourceFormat(img image.Image) Format {
+	if IsOpaque(img) {
+		return JPEG
+	}
+	return PNG
+}
+
+// Resize уменьшает изображение до ширины width с сохранением пропорций.
+// Изображения уже не шире width не увеличиваются.
+func Resize(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	if width <= 0 || bounds.Dx() <= width {
+		return src
+	}
+
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+	return dst
+}
+
+// Encode кодирует изображение в указанный формат
+func Encode(w io.Writer, img image.Image, format Format) error {
+	switch format {
+	case JPEG:
+		// JPEG не поддерживает прозрачность, поэтому подкладываем белый фон
+		if !IsOpaque(img) {
+			flattened := image.NewRGBA(img.Bounds())
+			draw.Draw(flattened, flattened.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+			draw.Draw(flattened, flattened.Bounds(), img, img.Bounds().Min, draw.Over)
+			img = flattened
+		}
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	case PNG:
+		return png.Encode(w, img)
+	case WebP:
+		return webp.Encode(w, img, &webp.Options{Quality: webpQuality})
+	case AVIF:
+		return encodeAVIF(w, img)
+	}
+	return fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+}
+
+// Render уменьшает изображение до ширины width и кодирует его
+func Render(src image.Image, width int, format Format) ([]byte, Variant, error) {
+	resized := Resize(src, width)
+
+	var buffer bytes.Buffer
+	if err := Encode(&buffer, resized, format); err != nil {
+		return nil, Variant{}, err
+	}
+
+	bounds := resized.Bounds()
+	return buffer.Bytes(), Variant{
+		Format: format,
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+		Size:   int64(buffer.Len()),
+	}, nil
+}
+
+// Extension возвращает расширение файла для формата
+func Extension(format Format) string {
+	if format == JPEG {
+		return ".jpg"
+	}
+	return "." + string(format)
+}
+
+// VariantKey возвращает ключ варианта рядом с оригиналом:
+// VariantKey("berserk/cover-1a2b.jpg", "card", WebP) -> "berserk/cover-1a2b-card.webp"
+func VariantKey(source, name string, format Format) string {
+	return strings.TrimSuffix(source, path.Ext(source)) + "-" + name + Extension(format)
+}
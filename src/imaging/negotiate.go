@@ -0,0 +1,127 @@
+package imaging
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Ширины, до которых округляется подсказка ?w=. Ограниченный набор не даёт
+// заполнить хранилище копиями на каждый возможный пиксель.
+var Widths = []int{160, 320, 480, 640, 800, 960, 1280, 1600, 1920}
+
+// derivedKey совпадает с ключами вариантов: "-card.webp", "-w320.avif", "-original.webp".
+// Из вариантов новые варианты не строятся.
+var derivedKey = regexp.MustCompile(`-(thumbnail|card|full|original|w\d+)\.[a-z]+$`)
+
+// sourceExtensions - расширения исходных изображений, для которых работает согласование,
+// и формат, в котором отдаётся вариант клиенту без поддержки AVIF и WebP
+var sourceExtensions = map[string]Format{
+	".jpg":  JPEG,
+	".jpeg": JPEG,
+	".png":  PNG,
+	".gif":  JPEG,
+	".webp": JPEG,
+}
+
+// ownFormats - собственный формат исходного файла. GIF сюда не входит:
+// в GIF варианты не кодируются.
+var ownFormats = map[string]Format{
+	".jpg":  JPEG,
+	".jpeg": JPEG,
+	".png":  PNG,
+	".webp": WebP,
+}
+
+// Negotiable сообщает, можно ли отдавать вместо объекта его вариант
+func Negotiable(key string) bool {
+	_, ok := sourceExtensions[strings.ToLower(path.Ext(key))]
+	return ok && !derivedKey.MatchString(key)
+}
+
+// SnapWidth округляет запрошенную ширину вверх до ближайшей из Widths.
+// 0 означает исходную ширину.
+func SnapWidth(hint string) int {
+	width, err := strconv.Atoi(hint)
+	if err != nil || width <= 0 {
+		return 0
+	}
+	for _, allowed := range Widths {
+		if width <= allowed {
+			return allowed
+		}
+	}
+	return 0
+}
+
+// acceptQuality возвращает вес q медиатипа из заголовка Accept.
+// Учитываются только явно перечисленные типы: "image/*" не обещает поддержку AVIF.
+func acceptQuality(accept, mediaType string) float64 {
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(params[0]), mediaType) {
+			continue
+		}
+		quality := 1.0
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.TrimSpace(name) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		return quality
+	}
+	return 0
+}
+
+// NegotiateFormat выбирает лучший формат по заголовку Accept: AVIF, затем WebP,
+// иначе формат, совместимый с исходным изображением key.
+func NegotiateFormat(accept, key string) Format {
+	if acceptQuality(accept, "image/avif") > 0 && AVIFAvailable() {
+		return AVIF
+	}
+	if acceptQuality(accept, "image/webp") > 0 {
+		return WebP
+	}
+	return sourceExtensions[strings.ToLower(path.Ext(key))]
+}
+
+// Negotiate решает, какой вариант объекта key отдать по заголовку Accept и подсказке ширины.
+// Возвращает false, если подходит сам объект.
+func Negotiate(key, accept, widthHint string) (int, Format, bool) {
+	if !Negotiable(key) {
+		return 0, "", false
+	}
+
+	ext := strings.ToLower(path.Ext(key))
+	width := SnapWidth(widthHint)
+	format := NegotiateFormat(accept, key)
+	if width == 0 {
+		own, ok := ownFormats[ext]
+		if format == own || (!ok && format == sourceExtensions[ext]) {
+			return 0, "", false
+		}
+	}
+	return width, format, true
+}
+
+// DerivedBase возвращает ключ исходного изображения без расширения для ключа варианта:
+// "berserk/cover-1a2b-w320.webp" -> "berserk/cover-1a2b". Для остальных ключей возвращает false.
+func DerivedBase(key string) (string, bool) {
+	location := derivedKey.FindStringIndex(key)
+	if location == nil {
+		return "", false
+	}
+	return key[:location[0]], true
+}
+
+// variantName - имя варианта для ширины: "w320" или "original"
+func variantName(width int) string {
+	if width == 0 {
+		return "original"
+	}
+	return "w" + strconv.Itoa(width)
+}
@@ -0,0 +1,125 @@
+package imaging
+
+import (
+	"os/exec"
+	"testing"
+)
+
+// setAVIFAvailable подменяет результат поиска avifenc на время теста
+func setAVIFAvailable(t *testing.T, available bool) {
+	t.Helper()
+	avifencOnce.Do(func() {
+		avifencPath, _ = exec.LookPath("avifenc")
+	})
+	previous := avifencPath
+	avifencPath = ""
+	if available {
+		avifencPath = "/usr/bin/avifenc"
+	}
+	t.Cleanup(func() { avifencPath = previous })
+}
+
+func TestAcceptQuality(t *testing.T) {
+	tests := []struct {
+		name      string
+		accept    string
+		mediaType string
+		want      float64
+	}{
+		{name: "listed", accept: "image/avif,image/webp,*/*", mediaType: "image/webp", want: 1},
+		{name: "with q", accept: "image/avif;q=0.8, image/webp", mediaType: "image/avif", want: 0.8},
+		{name: "spaces around q", accept: "image/webp ; q = 0.5", mediaType: "image/webp", want: 0.5},
+		{name: "refused", accept: "image/avif;q=0, image/webp", mediaType: "image/avif", want: 0},
+		{name: "case insensitive", accept: "Image/WebP", mediaType: "image/webp", want: 1},
+		{name: "malformed q", accept: "image/webp;q=abc", mediaType: "image/webp", want: 1},
+		{name: "wildcard does not count", accept: "*/*", mediaType: "image/webp", want: 0},
+		{name: "image wildcard does not count", accept: "image/*", mediaType: "image/avif", want: 0},
+		{name: "empty", accept: "", mediaType: "image/webp", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := acceptQuality(tt.accept, tt.mediaType); got != tt.want {
+				t.Errorf("acceptQuality(%q, %q) = %v, want %v", tt.accept, tt.mediaType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapWidth(t *testing.T) {
+	tests := []struct {
+		hint string
+		want int
+	}{
+		{hint: "", want: 0},
+		{hint: "abc", want: 0},
+		{hint: "-5", want: 0},
+		{hint: "1", want: 160},
+		{hint: "320", want: 320},
+		{hint: "321", want: 480},
+		{hint: "1920", want: 1920},
+		{hint: "4000", want: 0},
+	}
+	for _, tt := range tests {
+		if got := SnapWidth(tt.hint); got != tt.want {
+			t.Errorf("SnapWidth(%q) = %d, want %d", tt.hint, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	const chrome = "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8"
+	tests := []struct {
+		name       string
+		key        string
+		accept     string
+		width      string
+		avif       bool
+		wantWidth  int
+		wantFormat Format
+		wantOK     bool
+	}{
+		{name: "avif preferred", key: "berserk/cover.jpg", accept: chrome, avif: true, wantFormat: AVIF, wantOK: true},
+		{name: "webp without avifenc", key: "berserk/cover.jpg", accept: chrome, wantFormat: WebP, wantOK: true},
+		{name: "avif refused with q=0", key: "berserk/cover.jpg", accept: "image/avif;q=0,image/webp", avif: true, wantFormat: WebP, wantOK: true},
+		{name: "any type keeps original", key: "berserk/cover.jpg", accept: "*/*"},
+		{name: "image wildcard keeps original", key: "berserk/cover.png", accept: "image/*", avif: true},
+		{name: "webp source for webp client", key: "berserk/cover.webp", accept: "image/webp,*/*"},
+		{name: "webp source for old client", key: "berserk/cover.webp", accept: "*/*", wantFormat: JPEG, wantOK: true},
+		{name: "gif source for old client", key: "berserk/cover.gif", accept: "*/*"},
+		{name: "gif source for webp client", key: "berserk/cover.gif", accept: "image/webp", wantFormat: WebP, wantOK: true},
+		{name: "width for old client", key: "berserk/cover.png", accept: "*/*", width: "300", wantWidth: 320, wantFormat: PNG, wantOK: true},
+		{name: "width with avif", key: "berserk/cover.jpg", accept: chrome, width: "700", avif: true, wantWidth: 800, wantFormat: AVIF, wantOK: true},
+		{name: "width above the largest", key: "berserk/cover.jpg", accept: "*/*", width: "5000"},
+		{name: "derived key", key: "berserk/cover-w320.webp", accept: chrome, avif: true},
+		{name: "not an image", key: "berserk/chapter.cbz", accept: chrome},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setAVIFAvailable(t, tt.avif)
+			width, format, ok := Negotiate(tt.key, tt.accept, tt.width)
+			if width != tt.wantWidth || format != tt.wantFormat || ok != tt.wantOK {
+				t.Errorf("Negotiate() = (%d, %q, %v), want (%d, %q, %v)", width, format, ok, tt.wantWidth, tt.wantFormat, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDerivedBase(t *testing.T) {
+	tests := []struct {
+		key    string
+		want   string
+		wantOK bool
+	}{
+		{key: "berserk/cover-1a2b-w320.webp", want: "berserk/cover-1a2b", wantOK: true},
+		{key: "berserk/cover-1a2b-original.avif", want: "berserk/cover-1a2b", wantOK: true},
+		{key: "berserk/cover-1a2b-card.jpeg", want: "berserk/cover-1a2b", wantOK: true},
+		{key: "berserk/cover-1a2b.jpg"},
+		{key: "berserk/w320.webp"},
+	}
+	for _, tt := range tests {
+		got, ok := DerivedBase(tt.key)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("DerivedBase(%q) = (%q, %v), want (%q, %v)", tt.key, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
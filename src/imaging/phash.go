@@ -0,0 +1,76 @@
+package imaging
+
+import (
+	"image"
+	"math/bits"
+)
+
+// Размер сетки dHash: 9 столбцов дают 8 сравнений соседних ячеек в каждой из 8 строк
+const (
+	hashColumns = 9
+	hashRows    = 8
+	// Сколько точек на сторону ячейки усредняется. Выборка вместо полного
+	// уменьшения делает хэш одинаково быстрым для обложки и страницы вебтуна.
+	hashSamples = 16
+	// Разница яркости соседних ячеек, меньше которой они считаются одинаковыми.
+	// Без допуска шум пересжатия переворачивает биты на однотонном фоне страниц.
+	hashTolerance = 0xFFFF / 128
+)
+
+// DHash вычисляет разностный перцептивный хэш изображения. Изображение сводится к сетке 9x8
+// по яркости, каждый бит хэша сообщает, что ячейка заметно темнее соседней справа.
+// Хэш почти не меняется при пересжатии, смене формата и масштабировании.
+func DHash(img image.Image) uint64 {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return 0
+	}
+
+	var grid [hashRows][hashColumns]float64
+	for row := 0; row < hashRows; row++ {
+		for column := 0; column < hashColumns; column++ {
+			grid[row][column] = cellLuminance(img, bounds, column, row)
+		}
+	}
+
+	var hash uint64
+	for row := 0; row < hashRows; row++ {
+		for column := 0; column < hashColumns-1; column++ {
+			hash <<= 1
+			if grid[row][column]+hashTolerance < grid[row][column+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// cellLuminance усредняет яркость точек ячейки сетки. Прозрачные пиксели
+// накладываются на белый фон, как при отображении на странице.
+func cellLuminance(img image.Image, bounds image.Rectangle, column, row int) float64 {
+	var sum float64
+	for sy := 0; sy < hashSamples; sy++ {
+		y := bounds.Min.Y + ((row*hashSamples+sy)*2+1)*bounds.Dy()/(hashRows*hashSamples*2)
+		for sx := 0; sx < hashSamples; sx++ {
+			x := bounds.Min.X + ((column*hashSamples+sx)*2+1)*bounds.Dx()/(hashColumns*hashSamples*2)
+			r, g, b, a := img.At(x, y).RGBA()
+			background := 0xFFFF - a
+			sum += 0.299*float64(r+background) + 0.587*float64(g+background) + 0.114*float64(b+background)
+		}
+	}
+	return sum / (hashSamples * hashSamples)
+}
+
+// HammingDistance - число различающихся бит двух хэшей. Для dHash расстояние
+// до 5 обычно означает ту же картинку, больше 10 - разные.
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Informative сообщает, что хэш пригоден для поиска дубликатов. У однотонных
+// изображений (пустые и разделительные страницы) почти все биты одинаковы,
+// и такие хэши совпадали бы друг с другом во всех главах.
+func Informative(hash uint64) bool {
+	ones := bits.OnesCount64(hash)
+	return ones >= 4 && ones <= 60
+}
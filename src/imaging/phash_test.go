@@ -0,0 +1,92 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// pattern рисует крупные фигуры: хэш должен пережить масштабирование и пересжатие
+func pattern(width, height int, inverted bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			value := uint8(255 * x / width)
+			if (x*5/width+y*3/height)%2 == 1 {
+				value = 255 - value
+			}
+			if inverted {
+				value = 255 - value
+			}
+			img.Set(x, y, color.Gray{Y: value})
+		}
+	}
+	return img
+}
+
+func recompress(t *testing.T, img image.Image, quality int) image.Image {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestDHash(t *testing.T) {
+	original := pattern(400, 600, false)
+	hash := DHash(original)
+	if !Informative(hash) {
+		t.Fatalf("hash %#x of a pattern is not informative", hash)
+	}
+
+	tests := []struct {
+		name    string
+		img     image.Image
+		maxDist int // Наибольшее допустимое расстояние до оригинала
+		minDist int // Наименьшее
+	}{
+		{name: "same image", img: original, maxDist: 0},
+		{name: "resized", img: Resize(original, 200), maxDist: 5},
+		{name: "recompressed", img: recompress(t, original, 40), maxDist: 5},
+		{name: "inverted", img: pattern(400, 600, true), minDist: 20, maxDist: 64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distance := HammingDistance(hash, DHash(tt.img))
+			if distance < tt.minDist || distance > tt.maxDist {
+				t.Errorf("distance = %d, want %d-%d", distance, tt.minDist, tt.maxDist)
+			}
+		})
+	}
+}
+
+func TestDHashUninformative(t *testing.T) {
+	blank := image.NewRGBA(image.Rect(0, 0, 300, 300))
+	for i := range blank.Pix {
+		blank.Pix[i] = 0xFF
+	}
+	transparent := image.NewNRGBA(image.Rect(0, 0, 300, 300))
+
+	tests := []struct {
+		name string
+		img  image.Image
+	}{
+		{name: "white page", img: blank},
+		{name: "transparent page", img: transparent},
+		{name: "empty", img: image.NewRGBA(image.Rectangle{})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if hash := DHash(tt.img); Informative(hash) {
+				t.Errorf("hash %#x of %s is informative", hash, tt.name)
+			}
+		})
+	}
+}
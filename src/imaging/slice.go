@@ -0,0 +1,102 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+const (
+	// Разброс яркости (0-255) в строке, при котором строка считается пустой:
+	// белый или однотонный промежуток между панелями
+	flatRowTolerance = 12
+	// Сколько точек строки проверяется при поиске места разреза
+	flatRowSamples = 256
+)
+
+// FindCuts возвращает высоты, на которых высокое изображение режется на части не выше maxHeight.
+// Разрез ищется в пустой строке между панелями, начиная с maxHeight и вверх до половины
+// высоты части. Если пустой строки нет, выбирается самая однородная.
+func FindCuts(img image.Image, maxHeight int) []int {
+	bounds := img.Bounds()
+	height := bounds.Dy()
+	if maxHeight <= 0 || height <= maxHeight {
+		return nil
+	}
+
+	var cuts []int
+	top := 0
+	for height-top > maxHeight {
+		cut, bestSpread := top+maxHeight, 256
+		for y := top + maxHeight; y > top+maxHeight/2; y-- {
+			spread := rowSpread(img, bounds.Min.Y+y)
+			if spread < bestSpread {
+				cut, bestSpread = y, spread
+			}
+			if spread <= flatRowTolerance {
+				break
+			}
+		}
+		cuts = append(cuts, cut)
+		top = cut
+	}
+	return cuts
+}
+
+// rowSpread - разница между самой светлой и самой тёмной точкой строки y
+func rowSpread(img image.Image, y int) int {
+	bounds := img.Bounds()
+	step := bounds.Dx() / flatRowSamples
+	if step < 1 {
+		step = 1
+	}
+
+	minimum, maximum := 255, 0
+	for x := bounds.Min.X; x < bounds.Max.X; x += step {
+		r, g, b, a := img.At(x, y).RGBA()
+		background := 0xFFFF - a
+		luminance := int((299*(r+background) + 587*(g+background) + 114*(b+background)) / 1000 >> 8)
+		if luminance < minimum {
+			minimum = luminance
+		}
+		if luminance > maximum {
+			maximum = luminance
+		}
+	}
+	return maximum - minimum
+}
+
+// Slice режет изображение по высотам cuts из FindCuts. Части копируются
+// в новые изображения с началом координат в нуле.
+func Slice(img image.Image, cuts []int) []image.Image {
+	bounds := img.Bounds()
+	segments := make([]image.Image, 0, len(cuts)+1)
+	bottoms := append(append([]int{}, cuts...), bounds.Dy())
+	top := 0
+	for _, bottom := range bottoms {
+		segment := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bottom-top))
+		draw.Draw(segment, segment.Bounds(), img, image.Pt(bounds.Min.X, bounds.Min.Y+top), draw.Src)
+		segments = append(segments, segment)
+		top = bottom
+	}
+	return segments
+}
+
+// Stitch склеивает изображения одной ширины сверху вниз в порядке следования
+func Stitch(images []image.Image) image.Image {
+	width, height := 0, 0
+	for _, img := range images {
+		if img.Bounds().Dx() > width {
+			width = img.Bounds().Dx()
+		}
+		height += img.Bounds().Dy()
+	}
+
+	stitched := image.NewRGBA(image.Rect(0, 0, width, height))
+	top := 0
+	for _, img := range images {
+		bounds := img.Bounds()
+		draw.Draw(stitched, image.Rect(0, top, bounds.Dx(), top+bounds.Dy()), img, bounds.Min, draw.Src)
+		top += bounds.Dy()
+	}
+	return stitched
+}
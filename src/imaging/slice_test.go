@@ -0,0 +1,115 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// strip рисует вебтун шириной width: панели с одинаковым в каждой строке разбросом яркости, разделённые белыми промежутками
+// высотой gutter, которые начинаются на высотах gutters
+func strip(width, height, gutter int, gutters ...int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.Gray{Y: uint8(x * 37 % 200)})
+		}
+	}
+	for _, top := range gutters {
+		for y := top; y < top+gutter && y < height; y++ {
+			for x := 0; x < width; x++ {
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+	return img
+}
+
+func TestFindCuts(t *testing.T) {
+	tests := []struct {
+		name      string
+		img       image.Image
+		maxHeight int
+		want      []int
+	}{
+		{name: "short page", img: strip(50, 900, 10), maxHeight: 1000},
+		{name: "exactly max height", img: strip(50, 1000, 10), maxHeight: 1000},
+		{name: "slicing disabled", img: strip(50, 3000, 10), maxHeight: 0},
+		// Разрез на нижней строке промежутка, ближайшей к maxHeight
+		{name: "gutter below max", img: strip(50, 1500, 20, 800), maxHeight: 1000, want: []int{819}},
+		{name: "gutter at max", img: strip(50, 1500, 20, 990), maxHeight: 1000, want: []int{1000}},
+		{name: "several gutters", img: strip(50, 2600, 20, 700, 1500, 2300), maxHeight: 1000, want: []int{719, 1519, 2319}},
+		// Промежуток выше половины части не используется: части не должны быть слишком короткими
+		{name: "gutter too high", img: strip(50, 1500, 20, 300), maxHeight: 1000, want: []int{1000}},
+		{name: "no gutters", img: strip(50, 2100, 0), maxHeight: 1000, want: []int{1000, 2000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cuts := FindCuts(tt.img, tt.maxHeight)
+			if len(cuts) != len(tt.want) {
+				t.Fatalf("FindCuts() = %v, want %v", cuts, tt.want)
+			}
+			for i := range cuts {
+				if cuts[i] != tt.want[i] {
+					t.Fatalf("FindCuts() = %v, want %v", cuts, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSlice(t *testing.T) {
+	// Изображение с ненулевым началом координат, как после SubImage
+	full := strip(40, 2600, 20, 100, 900, 1700)
+	img := full.SubImage(image.Rect(0, 100, 40, 2600))
+
+	cuts := FindCuts(img, 1000)
+	segments := Slice(img, cuts)
+	if len(segments) != len(cuts)+1 {
+		t.Fatalf("%d segments for cuts %v", len(segments), cuts)
+	}
+
+	top := 0
+	for i, segment := range segments {
+		bounds := segment.Bounds()
+		if bounds.Min != (image.Point{}) {
+			t.Errorf("segment %d starts at %v, want origin", i, bounds.Min)
+		}
+		if bounds.Dx() != 40 || bounds.Dy() > 1000 {
+			t.Errorf("segment %d is %dx%d, want width 40 and height up to 1000", i, bounds.Dx(), bounds.Dy())
+		}
+		for _, y := range []int{0, bounds.Dy() / 2, bounds.Dy() - 1} {
+			if got, want := segment.At(7, y), img.At(7, img.Bounds().Min.Y+top+y); !sameColor(got, want) {
+				t.Errorf("segment %d row %d = %v, source has %v", i, y, got, want)
+			}
+		}
+		top += bounds.Dy()
+	}
+	if top != img.Bounds().Dy() {
+		t.Errorf("segments cover %d rows, image has %d", top, img.Bounds().Dy())
+	}
+
+	if stitched := Stitch(segments); !sameImage(stitched, img) {
+		t.Error("stitched segments differ from the source")
+	}
+}
+
+func sameColor(a, b color.Color) bool {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	return ar == br && ag == bg && ab == bb && aa == ba
+}
+
+func sameImage(a, b image.Image) bool {
+	if a.Bounds().Dx() != b.Bounds().Dx() || a.Bounds().Dy() != b.Bounds().Dy() {
+		return false
+	}
+	for y := 0; y < a.Bounds().Dy(); y++ {
+		for x := 0; x < a.Bounds().Dx(); x++ {
+			if !sameColor(a.At(a.Bounds().Min.X+x, a.Bounds().Min.Y+y), b.At(b.Bounds().Min.X+x, b.Bounds().Min.Y+y)) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,305 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+)
+
+// Limits - ограничения на загружаемое изображение
+type Limits struct {
+	MaxBytes  int
+	MinWidth  int
+	MinHeight int
+	MaxWidth  int
+	MaxHeight int
+	MaxPixels int // Защита от "бомб": маленький файл, огромное изображение после распаковки
+}
+
+var CoverLimits = Limits{
+	MaxBytes:  10 << 20,
+	MinWidth:  100,
+	MinHeight: 100,
+	MaxWidth:  6000,
+	MaxHeight: 9000,
+	MaxPixels: 40_000_000,
+}
+
+var BannerLimits = Limits{
+	MaxBytes:  15 << 20,
+	MinWidth:  320,
+	MinHeight: 100,
+	MaxWidth:  8000,
+	MaxHeight: 6000,
+	MaxPixels: 40_000_000,
+}
+
+// Страницы вебтунов бывают очень высокими, поэтому высота ограничена мягче
+var PageLimits = Limits{
+	MaxBytes:  50 << 20,
+	MinWidth:  100,
+	MinHeight: 100,
+	MaxWidth:  6000,
+	MaxHeight: 60000,
+	MaxPixels: 120_000_000,
+}
+
+// Форматы, которые принимаются при загрузке, по MIME типу из сигнатуры файла
+var allowedTypes = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// Фрагменты, которых не бывает в настоящих изображениях, но которые встречаются
+// в полиглотах, рассчитанных на исполнение в браузере или на сервере.
+// Короткие фрагменты вроде "<svg" не проверяются: они случайно встречаются в сжатых данных.
+var polyglotMarkers = [][]byte{
+	[]byte("<script"),
+	[]byte("<html"),
+	[]byte("<?php"),
+	[]byte("<iframe"),
+	[]byte("javascript:"),
+}
+
+// InvalidImageError - изображение не прошло проверку. Текст пригоден для ответа клиенту.
+type InvalidImageError struct {
+	Message string
+}
+
+func (e *InvalidImageError) Error() string {
+	return e.Message
+}
+
+func invalid(format string, args ...interface{}) error {
+	return &InvalidImageError{Message: fmt.Sprintf(format, args...)}
+}
+
+// IsInvalidImage сообщает, что ошибка вызвана содержимым файла, а не сбоем сервера
+func IsInvalidImage(err error) bool {
+	var invalidImage *InvalidImageError
+	return errors.As(err, &invalidImage)
+}
+
+// Info - результат проверки изображения
+type Info struct {
+	ContentType string
+	Format      string // jpeg, png, gif или webp
+	Width       int
+	Height      int
+}
+
+// Inspect проверяет загруженный файл: размер, сигнатуру, совпадение сигнатуры с декодером,
+// размеры изображения, полное декодирование и отсутствие данных после конца изображения.
+func Inspect(data []byte, limits Limits) (Info, image.Image, error) {
+	if len(data) == 0 {
+		return Info{}, nil, invalid("file is empty")
+	}
+	if limits.MaxBytes > 0 && len(data) > limits.MaxBytes {
+		return Info{}, nil, invalid("file is larger than %d MB", limits.MaxBytes>>20)
+	}
+
+	contentType := http.DetectContentType(data)
+	format, ok := allowedTypes[contentType]
+	if !ok {
+		return Info{}, nil, invalid("unsupported file type %s, expected JPEG, PNG, GIF or WebP", contentType)
+	}
+
+	// Размеры читаются из заголовка до полного декодирования, чтобы не распаковывать "бомбы"
+	config, decoded, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Info{}, nil, invalid("malformed %s image", format)
+	}
+	if decoded != format {
+		return Info{}, nil, invalid("file signature %s does not match image format %s", format, decoded)
+	}
+	// Decode поворачивает JPEG по EXIF Orientation, при значениях 5-8 ширина и высота меняются местами
+	width, height := config.Width, config.Height
+	if format == "jpeg" && jpegOrientation(data) >= 5 {
+		width, height = height, width
+	}
+	if err := checkDimensions(width, height, limits); err != nil {
+		return Info{}, nil, err
+	}
+
+	if err := checkTrailingData(data, format); err != nil {
+		return Info{}, nil, err
+	}
+	lower := bytes.ToLower(data)
+	for _, marker := range polyglotMarkers {
+		if bytes.Contains(lower, marker) {
+			return Info{}, nil, invalid("file contains embedded markup")
+		}
+	}
+
+	img, err := Decode(data)
+	if err != nil {
+		return Info{}, nil, invalid("malformed %s image", format)
+	}
+
+	// Размеры берутся из декодированного изображения: по ним сохраняются страницы и режутся вебтуны
+	bounds := img.Bounds()
+
+	return Info{ContentType: contentType, Format: format, Width: bounds.Dx(), Height: bounds.Dy()}, img, nil
+}
+
+func checkDimensions(width, height int, limits Limits) error {
+	if width < limits.MinWidth || height < limits.MinHeight {
+		return invalid("image is %dx%d, minimum is %dx%d", width, height, limits.MinWidth, limits.MinHeight)
+	}
+	if (limits.MaxWidth > 0 && width > limits.MaxWidth) || (limits.MaxHeight > 0 && height > limits.MaxHeight) {
+		return invalid("image is %dx%d, maximum is %dx%d", width, height, limits.MaxWidth, limits.MaxHeight)
+	}
+	if limits.MaxPixels > 0 && width*height > limits.MaxPixels {
+		return invalid("image has more than %d megapixels", limits.MaxPixels/1_000_000)
+	}
+	return nil
+}
+
+// checkTrailingData отклоняет файлы, к которым после конца изображения что-то дописано,
+// например ZIP архив или скрипт (GIFAR и подобные полиглоты)
+func checkTrailingData(data []byte, format string) error {
+	var end int
+	switch format {
+	case "jpeg":
+		end = jpegEnd(data)
+	case "png":
+		end = pngEnd(data)
+	case "gif":
+		end = gifEnd(data)
+	case "webp":
+		// RIFF заголовок хранит размер файла без первых 8 байт
+		if len(data) >= 12 {
+			size := int(binary.LittleEndian.Uint32(data[4:8])) + 8
+			if size%2 == 1 {
+				size++ // Чанки RIFF выравниваются до чётной длины
+			}
+			if size <= len(data) {
+				end = size
+			}
+		}
+	}
+
+	if end == 0 {
+		return invalid("malformed %s image: end of image not found", format)
+	}
+	if end < len(data) {
+		return invalid("file has %d bytes of unexpected data after the end of the image", len(data)-end)
+	}
+	return nil
+}
+
+// jpegEnd проходит по сегментам JPEG и возвращает позицию после маркера EOI (FFD9).
+// Нулевые байты после EOI допускаются: их дописывают некоторые камеры.
+func jpegEnd(data []byte) int {
+	offset := 2 // SOI
+	for offset+2 <= len(data) {
+		if data[offset] != 0xFF {
+			return 0
+		}
+		marker := data[offset+1]
+		switch {
+		case marker == 0xD9: // EOI
+			end := offset + 2
+			if len(bytes.Trim(data[end:], "\x00")) == 0 {
+				return len(data)
+			}
+			return end
+		case marker == 0xFF: // Заполняющие байты
+			offset++
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7): // Маркеры без длины
+			offset += 2
+			continue
+		}
+
+		if offset+4 > len(data) {
+			return 0
+		}
+		offset += 2 + int(binary.BigEndian.Uint16(data[offset+2:]))
+
+		// После SOS идут сжатые данные до следующего маркера.
+		// FF00 - экранированный байт, FFD0-FFD7 - маркеры перезапуска внутри данных.
+		if marker == 0xDA {
+			for offset+1 < len(data) {
+				if data[offset] == 0xFF && data[offset+1] != 0x00 && (data[offset+1] < 0xD0 || data[offset+1] > 0xD7) {
+					break
+				}
+				offset++
+			}
+		}
+	}
+	return 0
+}
+
+// pngEnd проходит по чанкам PNG и возвращает позицию после чанка IEND
+func pngEnd(data []byte) int {
+	offset := 8 // Сигнатура PNG
+	for offset+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		chunkType := string(data[offset+4 : offset+8])
+		next := offset + 12 + length
+		if length < 0 || next > len(data) {
+			return 0
+		}
+		if chunkType == "IEND" {
+			return next
+		}
+		offset = next
+	}
+	return 0
+}
+
+// gifEnd проходит по блокам GIF и возвращает позицию после трейлера 0x3B.
+// Проверки последнего байта недостаточно: дописанный скрипт тоже может заканчиваться на ";".
+func gifEnd(data []byte) int {
+	if len(data) < 13 {
+		return 0
+	}
+	offset := 13 // Заголовок и логический дескриптор экрана
+	if flags := data[10]; flags&0x80 != 0 {
+		offset += 3 << (flags&0x07 + 1) // Глобальная палитра
+	}
+
+	// skipSubBlocks пропускает последовательность подблоков, завершающуюся нулевым
+	skipSubBlocks := func(offset int) int {
+		for offset < len(data) {
+			size := int(data[offset])
+			offset++
+			if size == 0 {
+				return offset
+			}
+			offset += size
+		}
+		return -1
+	}
+
+	for offset < len(data) {
+		switch data[offset] {
+		case 0x3B: // Трейлер
+			return offset + 1
+		case 0x21: // Расширение: метка и подблоки
+			offset = skipSubBlocks(offset + 2)
+		case 0x2C: // Кадр: дескриптор, локальная палитра, размер кода LZW и подблоки
+			if offset+10 > len(data) {
+				return 0
+			}
+			flags := data[offset+9]
+			offset += 10
+			if flags&0x80 != 0 {
+				offset += 3 << (flags&0x07 + 1)
+			}
+			offset = skipSubBlocks(offset + 1)
+		default:
+			return 0
+		}
+		if offset < 0 {
+			return 0
+		}
+	}
+	return 0
+}
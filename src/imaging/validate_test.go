@@ -0,0 +1,184 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// Ограничения для маленьких тестовых изображений
+var testLimits = Limits{
+	MaxBytes:  1 << 20,
+	MinWidth:  1,
+	MinHeight: 1,
+	MaxWidth:  64,
+	MaxHeight: 64,
+	MaxPixels: 64 * 64,
+}
+
+// WebP без потерь 1x1: в стандартной библиотеке нет кодировщика WebP
+const webpFixture = "UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA=="
+
+// testImage рисует градиент, чтобы сжатые данные не были вырожденными
+func testImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 4), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(width, height), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(width, height)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeGIF(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, testImage(width, height), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decodeWebP(t *testing.T) []byte {
+	t.Helper()
+	data, err := base64.StdEncoding.DecodeString(webpFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// withJPEGSegment вставляет сегмент сразу после маркера SOI
+func withJPEGSegment(data []byte, marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	result := append([]byte{}, data[:2]...)
+	result = append(result, segment...)
+	return append(result, data[2:]...)
+}
+
+// withOrientation добавляет в JPEG EXIF блок с тегом Orientation
+func withOrientation(data []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2A\x00\x00\x00\x08")
+	entry := make([]byte, 2+12+4)
+	binary.BigEndian.PutUint16(entry[0:], 1)      // Количество записей IFD0
+	binary.BigEndian.PutUint16(entry[2:], 0x0112) // Orientation
+	binary.BigEndian.PutUint16(entry[4:], 3)      // SHORT
+	binary.BigEndian.PutUint32(entry[6:], 1)
+	binary.BigEndian.PutUint16(entry[10:], orientation)
+	payload := append([]byte("Exif\x00\x00"), append(tiff, entry...)...)
+	return withJPEGSegment(data, 0xE1, payload)
+}
+
+// withPNGChunk вставляет чанк перед IEND
+func withPNGChunk(data []byte, chunkType string, payload []byte) []byte {
+	chunk := make([]byte, 4, 12+len(payload))
+	binary.BigEndian.PutUint32(chunk, uint32(len(payload)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, payload...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	iend := len(data) - 12
+	result := append([]byte{}, data[:iend]...)
+	result = append(result, chunk...)
+	return append(result, data[iend:]...)
+}
+
+func TestInspect(t *testing.T) {
+	jpegData := encodeJPEG(t, 40, 20)
+	pngData := encodePNG(t, 40, 20)
+	gifData := encodeGIF(t, 40, 20)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		limits  Limits
+		want    Info
+		wantErr string // Фрагмент текста ошибки, пустой - изображение принимается
+	}{
+		{name: "jpeg", data: jpegData, want: Info{ContentType: "image/jpeg", Format: "jpeg", Width: 40, Height: 20}},
+		{name: "png", data: pngData, want: Info{ContentType: "image/png", Format: "png", Width: 40, Height: 20}},
+		{name: "gif", data: gifData, want: Info{ContentType: "image/gif", Format: "gif", Width: 40, Height: 20}},
+		{name: "webp", data: decodeWebP(t), want: Info{ContentType: "image/webp", Format: "webp", Width: 1, Height: 1}},
+		{name: "jpeg with zero padding", data: append(append([]byte{}, jpegData...), 0, 0, 0), want: Info{ContentType: "image/jpeg", Format: "jpeg", Width: 40, Height: 20}},
+
+		{name: "empty", data: nil, wantErr: "file is empty"},
+		{name: "too many bytes", data: pngData, limits: Limits{MaxBytes: 16}, wantErr: "file is larger"},
+		{name: "unsupported type", data: []byte("BM not really a bitmap"), wantErr: "unsupported file type"},
+		{name: "signature does not match contents", data: append([]byte("\x89PNG\r\n\x1a\n"), jpegData...), wantErr: "malformed png"},
+		{name: "truncated", data: jpegData[:len(jpegData)/2], wantErr: "malformed jpeg"},
+
+		{name: "below minimum", data: pngData, limits: Limits{MinWidth: 50, MinHeight: 10}, wantErr: "minimum is 50x10"},
+		{name: "wider than maximum", data: pngData, limits: Limits{MaxWidth: 30, MaxHeight: 64}, wantErr: "maximum is 30x64"},
+		{name: "too many pixels", data: pngData, limits: Limits{MaxPixels: 500}, wantErr: "megapixels"},
+
+		{name: "zip after png", data: append(append([]byte{}, pngData...), "PK\x03\x04payload"...), wantErr: "unexpected data after the end"},
+		{name: "script after gif", data: append(append([]byte{}, gifData...), "alert(1);"...), wantErr: "unexpected data after the end"},
+		{name: "bytes after jpeg", data: append(append([]byte{}, jpegData...), "tail"...), wantErr: "unexpected data after the end"},
+		{name: "bytes after webp", data: append(decodeWebP(t), "tail"...), wantErr: "unexpected data after the end"},
+
+		{name: "script in png chunk", data: withPNGChunk(pngData, "tEXt", []byte("Comment\x00<SCRIPT>alert(1)</SCRIPT>")), wantErr: "embedded markup"},
+		{name: "php in jpeg comment", data: withJPEGSegment(jpegData, 0xFE, []byte("<?php system($_GET[0]); ?>")), wantErr: "embedded markup"},
+
+		// Orientation 6 поворачивает 40x20 на 90 градусов: проверяются и возвращаются размеры после поворота
+		{name: "exif rotated", data: withOrientation(jpegData, 6), limits: Limits{MaxWidth: 30, MaxHeight: 64}, want: Info{ContentType: "image/jpeg", Format: "jpeg", Width: 20, Height: 40}},
+		{name: "exif rotated too tall", data: withOrientation(jpegData, 6), limits: Limits{MaxWidth: 64, MaxHeight: 30}, wantErr: "image is 20x40"},
+		{name: "exif mirrored", data: withOrientation(jpegData, 2), limits: Limits{MaxWidth: 30, MaxHeight: 64}, wantErr: "image is 40x20"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits := tt.limits
+			if limits == (Limits{}) {
+				limits = testLimits
+			}
+
+			info, img, err := Inspect(tt.data, limits)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Inspect() error = %v, want %q", err, tt.wantErr)
+				}
+				if !IsInvalidImage(err) {
+					t.Errorf("Inspect() error %v is not an InvalidImageError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Inspect() error = %v", err)
+			}
+			if info != tt.want {
+				t.Errorf("Inspect() info = %+v, want %+v", info, tt.want)
+			}
+			if bounds := img.Bounds(); bounds.Dx() != info.Width || bounds.Dy() != info.Height {
+				t.Errorf("decoded image is %dx%d, info reports %dx%d", bounds.Dx(), bounds.Dy(), info.Width, info.Height)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// tokenParam - одноразовый токен в ссылке из письма
+var tokenParam = regexp.MustCompile(`([?&]token=)[^&\s]+`)
+
+// Log пишет письма в журнал вместо отправки. Токены в ссылках скрываются: журнал читают не только
+// получатели писем. Чтобы переходить по ссылкам при разработке, используйте драйвер file.
+type Log struct{}
+
+func (Log) Send(message Message) error {
+	if _, err := build(message); err != nil {
+		return err
+	}
+	log.Printf("Mail to %s: %s\n%s", message.To, message.Subject, redactTokens(message.Text))
+	return nil
+}
+
+// redactTokens заменяет значения параметров token в ссылках
+func redactTokens(text string) string {
+	return tokenParam.ReplaceAllString(text, "${1}REDACTED")
+}
+
+// File сохраняет письма в директорию файлами .eml, которые открываются почтовым клиентом
+type File struct {
+	dir string
+}
+
+func NewFile(dir string) (*File, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &File{dir: dir}, nil
+}
+
+func (f *File) Send(message Message) error {
+	data, err := build(message)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(f.dir, fmt.Sprintf("%s-*.eml", time.Now().Format("20060102-150405")))
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	log.Printf("Mail to %s saved to %s", message.To, filepath.Base(file.Name()))
+	return nil
+}
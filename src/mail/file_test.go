@@ -0,0 +1,115 @@
+package mail
+
+import (
+	"bytes"
+	"log"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "verification link",
+			text: "http://localhost:3000/verify-email?token=abc_DEF-123",
+			want: "http://localhost:3000/verify-email?token=REDACTED",
+		},
+		{
+			name: "token among other parameters",
+			text: "http://localhost:3000/reset-password?lang=ru&token=abc&next=/",
+			want: "http://localhost:3000/reset-password?lang=ru&token=REDACTED&next=/",
+		},
+		{
+			name: "several links",
+			text: "?token=one\n?token=two",
+			want: "?token=REDACTED\n?token=REDACTED",
+		},
+		{
+			name: "similar parameter name",
+			text: "http://localhost:3000/?csrf_token=abc",
+			want: "http://localhost:3000/?csrf_token=abc",
+		},
+		{name: "no links", text: "Здравствуйте!", want: "Здравствуйте!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactTokens(tt.text); got != tt.want {
+				t.Errorf("redactTokens() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogRedactsTokens(t *testing.T) {
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stderr)
+
+	err := Log{}.Send(Message{
+		To:      "reader@example.com",
+		Subject: "Подтвердите email",
+		Text:    "http://localhost:3000/verify-email?token=secret-token-value\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(output.String(), "secret-token-value") {
+		t.Errorf("log contains the token:\n%s", output.String())
+	}
+	if !strings.Contains(output.String(), "reader@example.com") {
+		t.Errorf("log does not mention the recipient:\n%s", output.String())
+	}
+}
+
+func TestFileSend(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	sender, err := NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		message Message
+		wantErr bool
+	}{
+		{name: "first", message: Message{To: "reader@example.com", Subject: "One", Text: "?token=kept-in-file"}},
+		{name: "second in the same second", message: Message{To: "reader@example.com", Subject: "Two", Text: "Hi"}},
+		{name: "invalid recipient", message: Message{To: "reader", Subject: "Three"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := sender.Send(tt.message); (err != nil) != tt.wantErr {
+				t.Errorf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("%d .eml files saved, want 2", len(files))
+	}
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := netmail.ReadMessage(bytes.NewReader(data)); err != nil {
+			t.Errorf("%s is not a valid message: %v", filepath.Base(name), err)
+		}
+		// В файле ссылка остаётся целой, чтобы по ней можно было перейти при разработке
+		if strings.Contains(string(data), "REDACTED") {
+			t.Errorf("%s has a redacted token", filepath.Base(name))
+		}
+	}
+}
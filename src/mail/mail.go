@@ -0,0 +1,135 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"os"
+	"strings"
+	"time"
+)
+
+// Message - текстовое письмо
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// Sender отправляет письма
+type Sender interface {
+	Send(message Message) error
+}
+
+// Default - отправитель приложения, настраивается в Open
+var Default Sender
+
+// from - адрес отправителя, переменная окружения MAIL_FROM
+var from = "WaManga <no-reply@localhost>"
+
+// Open создаёт отправителя по переменным окружения: MAIL_DRIVER=log (письма пишутся в журнал), file или smtp.
+// Без MAIL_DRIVER письма пишутся в журнал только при разработке: в режиме GIN_MODE=release
+// сервер не запускается, чтобы письма не пропадали молча.
+func Open() {
+	var err error
+
+	if address := os.Getenv("MAIL_FROM"); address != "" {
+		from = address
+	}
+	if _, err := netmail.ParseAddress(from); err != nil {
+		panic(fmt.Errorf("invalid MAIL_FROM %q: %w", from, err))
+	}
+
+	driver := os.Getenv("MAIL_DRIVER")
+	if driver == "" {
+		if os.Getenv("GIN_MODE") == "release" {
+			panic("MAIL_DRIVER is not set: choose log, file or smtp explicitly")
+		}
+		log.Println("MAIL_DRIVER is not set, mail will be written to the log")
+	}
+
+	switch driver {
+	case "", "log":
+		Default = Log{}
+	case "file":
+		dir := os.Getenv("MAIL_FILE_DIR")
+		if dir == "" {
+			dir = "./main/mail"
+		}
+		Default, err = NewFile(dir)
+	case "smtp":
+		Default, err = NewSMTP(SMTPConfig{
+			Host:     os.Getenv("MAIL_SMTP_HOST"),
+			Port:     os.Getenv("MAIL_SMTP_PORT"),
+			Username: os.Getenv("MAIL_SMTP_USER"),
+			Password: os.Getenv("MAIL_SMTP_PASSWORD"),
+			TLS:      os.Getenv("MAIL_SMTP_TLS"),
+		})
+	default:
+		err = fmt.Errorf("unknown mail driver %q", driver)
+	}
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Send отправляет письмо через Default
+func Send(message Message) error {
+	return Default.Send(message)
+}
+
+// build собирает письмо в формате RFC 5322. Тема кодируется по RFC 2047, текст - quoted-printable.
+func build(message Message) ([]byte, error) {
+	to, err := netmail.ParseAddress(message.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient %q: %w", message.To, err)
+	}
+	// Перевод строки в заголовке позволил бы дописать свои заголовки
+	if strings.ContainsAny(message.To+message.Subject, "\r\n") {
+		return nil, fmt.Errorf("mail headers must not contain line breaks")
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	sender, err := netmail.ParseAddress(from)
+	if err != nil {
+		return nil, err
+	}
+	_, domain, _ := strings.Cut(sender.Address, "@")
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", sender)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	writer := quotedprintable.NewWriter(&buf)
+	if _, err := writer.Write([]byte(strings.ReplaceAll(message.Text, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// envelopeFrom - адрес отправителя для команды MAIL FROM
+func envelopeFrom() string {
+	address, err := netmail.ParseAddress(from)
+	if err != nil {
+		return from
+	}
+	return address.Address
+}
@@ -0,0 +1,103 @@
+package mail
+
+import (
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name    string
+		message Message
+		wantErr bool
+	}{
+		{name: "verification mail", message: Message{
+			To:      "reader@example.com",
+			Subject: "Подтвердите email",
+			Text:    "Перейдите по ссылке:\nhttp://localhost:3000/verify-email?token=" + strings.Repeat("a", 90) + "\n",
+		}},
+		{name: "recipient with name", message: Message{To: "Reader <reader@example.com>", Subject: "Hello", Text: "Hi"}},
+		{name: "invalid recipient", message: Message{To: "reader", Subject: "Hello"}, wantErr: true},
+		{name: "line break in subject", message: Message{To: "reader@example.com", Subject: "Hello\r\nBcc: victim@example.com"}, wantErr: true},
+		{name: "line break in recipient", message: Message{To: "reader@example.com\nBcc: victim@example.com", Subject: "Hello"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := build(tt.message)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("build() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			parsed, err := netmail.ReadMessage(strings.NewReader(string(data)))
+			if err != nil {
+				t.Fatalf("parse built message: %v", err)
+			}
+			to, err := parsed.Header.AddressList("To")
+			if err != nil || len(to) != 1 {
+				t.Fatalf("To header %q: %v", parsed.Header.Get("To"), err)
+			}
+			want, _ := netmail.ParseAddress(tt.message.To)
+			if to[0].Address != want.Address {
+				t.Errorf("To = %q, want %q", to[0].Address, want.Address)
+			}
+			subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+			if err != nil || subject != tt.message.Subject {
+				t.Errorf("Subject = %q (%v), want %q", subject, err, tt.message.Subject)
+			}
+			if parsed.Header.Get("Message-ID") == "" || parsed.Header.Get("Date") == "" {
+				t.Error("Message-ID or Date header is missing")
+			}
+
+			body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+			if err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if got := strings.ReplaceAll(string(body), "\r\n", "\n"); got != tt.message.Text {
+				t.Errorf("body = %q, want %q", got, tt.message.Text)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		name      string
+		driver    string
+		ginMode   string
+		want      Sender
+		wantPanic bool
+	}{
+		{name: "default in development", want: Log{}},
+		{name: "default in release", ginMode: "release", wantPanic: true},
+		{name: "log in release", driver: "log", ginMode: "release", want: Log{}},
+		{name: "file", driver: "file", want: &File{}},
+		{name: "smtp without host", driver: "smtp", wantPanic: true},
+		{name: "unknown", driver: "sendmail", wantPanic: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAIL_DRIVER", tt.driver)
+			t.Setenv("GIN_MODE", tt.ginMode)
+			t.Setenv("MAIL_FILE_DIR", t.TempDir())
+			t.Setenv("MAIL_SMTP_HOST", "")
+
+			defer func() {
+				if recovered := recover(); (recovered != nil) != tt.wantPanic {
+					t.Errorf("Open() panic = %v, wantPanic %v", recovered, tt.wantPanic)
+				}
+			}()
+			Open()
+			if reflect.TypeOf(Default) != reflect.TypeOf(tt.want) {
+				t.Errorf("Open() driver = %T, want %T", Default, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package mail
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"time"
+)
+
+// SMTPConfig - параметры подключения к SMTP серверу
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	// TLS: starttls (по умолчанию, если сервер его поддерживает), tls (порт 465) или none.
+	// Локальные заглушки вроде MailHog работают без TLS и авторизации.
+	TLS string
+}
+
+// SMTP отправляет письма через SMTP сервер. Соединение открывается на каждое письмо.
+type SMTP struct {
+	config SMTPConfig
+}
+
+func NewSMTP(config SMTPConfig) (*SMTP, error) {
+	if config.Host == "" {
+		return nil, errors.New("MAIL_SMTP_HOST is required for the smtp mail driver")
+	}
+	switch config.TLS {
+	case "":
+		config.TLS = "starttls"
+	case "starttls", "tls", "none":
+	default:
+		return nil, fmt.Errorf("unknown MAIL_SMTP_TLS mode %q", config.TLS)
+	}
+	if config.Port == "" {
+		config.Port = "587"
+		if config.TLS == "tls" {
+			config.Port = "465"
+		}
+	}
+	return &SMTP{config: config}, nil
+}
+
+func (s *SMTP) Send(message Message) error {
+	data, err := build(message)
+	if err != nil {
+		return err
+	}
+	to, err := netmail.ParseAddress(message.To)
+	if err != nil {
+		return err
+	}
+
+	address := net.JoinHostPort(s.config.Host, s.config.Port)
+	tlsConfig := &tls.Config{ServerName: s.config.Host}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+	var conn net.Conn
+	if s.config.TLS == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return err
+	}
+	// Зависший сервер не должен задерживать запрос бесконечно
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if s.config.TLS == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		}
+	}
+	if s.config.Username != "" {
+		// PlainAuth отказывается передавать пароль без TLS, кроме как на localhost
+		if err := client.Auth(smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(envelopeFrom()); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,125 @@
+package mail
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mailhogMessages - ответ MailHog на GET /api/v2/search, из писем нужен только исходный текст
+type mailhogMessages struct {
+	Total int `json:"total"`
+	Items []struct {
+		Raw struct {
+			Data string `json:"Data"`
+		} `json:"Raw"`
+	} `json:"items"`
+}
+
+func TestNewSMTP(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   SMTPConfig
+		wantTLS  string
+		wantPort string
+		wantErr  bool
+	}{
+		{name: "defaults", config: SMTPConfig{Host: "smtp.example.com"}, wantTLS: "starttls", wantPort: "587"},
+		{name: "implicit tls", config: SMTPConfig{Host: "smtp.example.com", TLS: "tls"}, wantTLS: "tls", wantPort: "465"},
+		{name: "mailhog", config: SMTPConfig{Host: "localhost", Port: "1025", TLS: "none"}, wantTLS: "none", wantPort: "1025"},
+		{name: "no host", config: SMTPConfig{}, wantErr: true},
+		{name: "unknown tls mode", config: SMTPConfig{Host: "smtp.example.com", TLS: "ssl"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender, err := NewSMTP(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSMTP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if sender.config.TLS != tt.wantTLS || sender.config.Port != tt.wantPort {
+				t.Errorf("NewSMTP() = %s on port %s, want %s on port %s", sender.config.TLS, sender.config.Port, tt.wantTLS, tt.wantPort)
+			}
+		})
+	}
+}
+
+// TestSMTPMailHog отправляет письмо подтверждения email через драйвер smtp в MailHog
+// и проверяет по API MailHog, что оно пришло целым. Запускается только при MAILHOG_HOST,
+// например MAILHOG_HOST=localhost go test ./src/mail (SMTP на порту 1025, API на 8025).
+func TestSMTPMailHog(t *testing.T) {
+	host := os.Getenv("MAILHOG_HOST")
+	if host == "" {
+		t.Skip("MAILHOG_HOST is not set")
+	}
+
+	sender, err := NewSMTP(SMTPConfig{Host: host, Port: "1025", TLS: "none"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Уникальный получатель, чтобы не найти письма прошлых запусков
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatal(err)
+	}
+	to := "reader-" + hex.EncodeToString(id) + "@example.com"
+	link := "http://localhost:3000/verify-email?token=" + hex.EncodeToString(id) + strings.Repeat("x", 80)
+	message := Message{
+		To:      to,
+		Subject: "Подтвердите email",
+		Text:    "Здравствуйте, reader!\n\nЧтобы подтвердить адрес, перейдите по ссылке:\n" + link + "\n",
+	}
+	if err := sender.Send(message); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	api := "http://" + net.JoinHostPort(host, "8025") + "/api/v2/search?kind=to&query=" + url.QueryEscape(to)
+	var found mailhogMessages
+	for attempt := 0; attempt < 10 && found.Total == 0; attempt++ {
+		if attempt > 0 {
+			time.Sleep(500 * time.Millisecond)
+		}
+		response, err := http.Get(api)
+		if err != nil {
+			t.Fatalf("mailhog api: %v", err)
+		}
+		err = json.NewDecoder(response.Body).Decode(&found)
+		response.Body.Close()
+		if err != nil {
+			t.Fatalf("mailhog api: %v", err)
+		}
+	}
+	if found.Total != 1 || len(found.Items) != 1 {
+		t.Fatalf("mailhog has %d messages for %s, want 1", found.Total, to)
+	}
+
+	received, err := netmail.ReadMessage(strings.NewReader(found.Items[0].Raw.Data))
+	if err != nil {
+		t.Fatalf("parse received message: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(received.Header.Get("Subject"))
+	if err != nil || subject != message.Subject {
+		t.Errorf("subject = %q (%v), want %q", subject, err, message.Subject)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(received.Body))
+	if err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if !strings.Contains(string(body), link) {
+		t.Errorf("body does not contain the verification link intact:\n%s", body)
+	}
+}
@@ -1,6 +1,7 @@
 package middlewares
 
 import (
+	"errors"
 	"log"
 	"strings"
 
@@ -31,21 +32,42 @@ func AuthMiddleware() gin.HandlerFunc {
 		// Извлекаем сам токен
 		reqToken := splitToken[1]
 
-		// Декодируем и проверяем токен
-		claims, err := models.DecodeToken(reqToken)
+		// Декодируем и проверяем токен, в том числе что вход не завершён
+		claims, err := models.AuthenticateToken(reqToken)
+		if errors.Is(err, models.ErrTokenRevoked) {
+			c.AbortWithStatusJSON(401, gin.H{"error": "Token has been revoked"})
+			return
+		}
 		if err != nil {
 			log.Printf("Error decoding token: %v\n", err) // Логирование ошибки при декодировании токена
 			c.AbortWithStatusJSON(401, gin.H{"error": "Invalid token"})
 			return
 		}
 
-		// Логируем данные claims для отладки
-		log.Printf("Claims: %v\n", claims)
-
 		// Используем данные из claims для установки userId в контексте
 		c.Set("userId", claims.Id) // Замените на соответствующее поле, если нужно
+		c.Set("role", claims.Role)
+		c.Set("sessionId", claims.SessionID)
 
 		// Переходим к следующему обработчику
 		c.Next()
 	}
 }
+
+// OptionalAuthMiddleware устанавливает userId, если передан корректный токен,
+// но не отклоняет анонимные запросы
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const bearerPrefix = "Bearer "
+		token := c.GetHeader("Authorization")
+		if strings.HasPrefix(token, bearerPrefix) {
+			if claims, err := models.AuthenticateToken(token[len(bearerPrefix):]); err == nil {
+				c.Set("userId", claims.Id)
+				c.Set("role", claims.Role)
+				c.Set("sessionId", claims.SessionID)
+			}
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,38 @@
+package middlewares
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"main/src/models"
+)
+
+// RequirePermission пропускает запрос, только если роль пользователя даёт указанное право.
+// Используется после AuthMiddleware. Каждое обращение, включая отказы, записывается в журнал аудита.
+func RequirePermission(permission models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, _ := c.Get("role")
+		userRole, _ := role.(models.Role)
+
+		if !models.HasPermission(userRole, permission) {
+			c.AbortWithStatusJSON(403, gin.H{"error": "Insufficient permissions"})
+		} else {
+			c.Next()
+		}
+
+		userId, _ := strconv.ParseUint(c.GetString("userId"), 10, 64)
+		entry := models.AuditLog{
+			UserID:     uint(userId),
+			Role:       userRole,
+			Permission: permission,
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.Path,
+			Status:     c.Writer.Status(),
+			IP:         c.ClientIP(),
+		}
+		if err := models.CreateAuditLog(&entry); err != nil {
+			log.Printf("Failed to write audit log: %v\n", err)
+		}
+	}
+}
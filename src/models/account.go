@@ -0,0 +1,228 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"main/src/mail"
+	"main/src/utils"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultEmailVerificationTTL = 48 * time.Hour
+	DefaultPasswordResetTTL     = time.Hour
+	// Письма одного назначения одному пользователю отправляются не чаще, чтобы формой нельзя было завалить чужой ящик
+	accountMailInterval = time.Minute
+)
+
+// Назначение одноразового токена из письма
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeResetPassword = "reset_password"
+)
+
+var (
+	ErrAccountTokenInvalid = errors.New("invalid or expired token")
+	ErrEmailVerified       = errors.New("email is already verified")
+	ErrAccountMailTooOften = errors.New("the email has just been sent, try again in a minute")
+)
+
+// AccountToken - одноразовый токен из письма для подтверждения email или сброса пароля.
+// В базе хранится только хэш токена.
+type AccountToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index"`
+	Purpose   string    `gorm:"size:32"`
+	TokenHash string    `gorm:"size:64;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// AppURL - адрес сайта, на который ведут ссылки из писем, переменная окружения APP_URL
+func AppURL() string {
+	return strings.TrimSuffix(utils.GetEnv("APP_URL", "http://localhost:3000"), "/")
+}
+
+// issueAccountToken выдаёт новый токен и отменяет прежние неиспользованные токены
+// того же назначения: действует только ссылка из последнего письма
+func issueAccountToken(userID uint, purpose string, ttl time.Duration) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	err = Database.Transaction(func(tx *gorm.DB) error {
+		var recent int64
+		err := tx.Model(&AccountToken{}).
+			Where("user_id = ? AND purpose = ? AND created_at > ?", userID, purpose, time.Now().Add(-accountMailInterval)).
+			Count(&recent).Error
+		if err != nil {
+			return err
+		}
+		if recent > 0 {
+			return ErrAccountMailTooOften
+		}
+
+		err = tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).Delete(&AccountToken{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&AccountToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: hashToken(token),
+			ExpiresAt: time.Now().Add(ttl),
+		}).Error
+	})
+	return token, err
+}
+
+// useAccountToken погашает токен и возвращает пользователя, которому он выдан.
+// Токен принимается один раз, даже если его предъявят два запроса одновременно.
+func useAccountToken(tx *gorm.DB, token, purpose string) (uint, error) {
+	var stored AccountToken
+	err := tx.Where("token_hash = ? AND purpose = ?", hashToken(token), purpose).First(&stored).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrAccountTokenInvalid
+	} else if err != nil {
+		return 0, err
+	}
+	if stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return 0, ErrAccountTokenInvalid
+	}
+
+	result := tx.Model(&AccountToken{}).
+		Where("id = ? AND used_at IS NULL", stored.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, ErrAccountTokenInvalid
+	}
+	return stored.UserID, nil
+}
+
+// humanDuration записывает срок действия ссылки для письма: "48 ч", "30 мин"
+func humanDuration(duration time.Duration) string {
+	if duration >= time.Hour && duration%time.Hour == 0 {
+		return fmt.Sprintf("%d ч", duration/time.Hour)
+	}
+	return fmt.Sprintf("%d мин", duration/time.Minute)
+}
+
+// accountLink собирает ссылку из письма на страницу сайта
+func accountLink(page, token string) string {
+	return AppURL() + page + "?token=" + url.QueryEscape(token)
+}
+
+// SendEmailVerification отправляет пользователю письмо со ссылкой для подтверждения email.
+// Срок действия ссылки задаётся переменной окружения EMAIL_VERIFICATION_TTL.
+func SendEmailVerification(user *User) error {
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailVerified
+	}
+
+	ttl := utils.GetDurationEnv("EMAIL_VERIFICATION_TTL", DefaultEmailVerificationTTL)
+	token, err := issueAccountToken(user.ID, TokenPurposeVerifyEmail, ttl)
+	if err != nil {
+		return err
+	}
+	return mail.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Подтвердите email",
+		Text: fmt.Sprintf("Здравствуйте, %s!\n\nЧтобы подтвердить адрес, перейдите по ссылке:\n%s\n\n"+
+			"Ссылка действует %s. Если вы не регистрировались, просто удалите это письмо.\n",
+			user.Username, accountLink("/verify-email", token), humanDuration(ttl)),
+	})
+}
+
+// VerifyEmail подтверждает email по токену из письма
+func VerifyEmail(token string) (*User, error) {
+	var user User
+	err := Database.Transaction(func(tx *gorm.DB) error {
+		userID, err := useAccountToken(tx, token, TokenPurposeVerifyEmail)
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+		if user.EmailVerifiedAt == nil {
+			now := time.Now()
+			user.EmailVerifiedAt = &now
+			return tx.Model(&user).Update("email_verified_at", now).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// RequestPasswordReset отправляет письмо со ссылкой для сброса пароля. Если пользователя
+// с таким email нет, ничего не происходит: ответ не должен выдавать, зарегистрирован ли адрес.
+// Срок действия ссылки задаётся переменной окружения PASSWORD_RESET_TTL.
+func RequestPasswordReset(email string) error {
+	var user User
+	err := Database.Where("email = ?", email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	ttl := utils.GetDurationEnv("PASSWORD_RESET_TTL", DefaultPasswordResetTTL)
+	token, err := issueAccountToken(user.ID, TokenPurposeResetPassword, ttl)
+	if err != nil {
+		return err
+	}
+	return mail.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Сброс пароля",
+		Text: fmt.Sprintf("Здравствуйте, %s!\n\nЧтобы задать новый пароль, перейдите по ссылке:\n%s\n\n"+
+			"Ссылка действует %s и сработает один раз. Если вы не запрашивали сброс, просто удалите это письмо: пароль не изменится.\n",
+			user.Username, accountLink("/reset-password", token), humanDuration(ttl)),
+	})
+}
+
+// ResetPassword задаёт новый пароль по токену из письма и завершает все сессии пользователя.
+// Письмо пришло на адрес пользователя, поэтому email заодно считается подтверждённым.
+func ResetPassword(token, password string) error {
+	user := User{Password: password}
+	if err := user.HashPassword(); err != nil {
+		return err
+	}
+
+	return Database.Transaction(func(tx *gorm.DB) error {
+		userID, err := useAccountToken(tx, token, TokenPurposeResetPassword)
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"password":          user.Password,
+			"email_verified_at": gorm.Expr("COALESCE(email_verified_at, ?)", time.Now()),
+		}).Error
+		if err != nil {
+			return err
+		}
+		// Тот, кто знал старый пароль, мог уже войти
+		return tx.Model(&TokenFamily{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+// sendWelcomeMail отправляет письмо подтверждения после регистрации. Ошибка почты
+// не отменяет регистрацию: письмо можно запросить повторно.
+func sendWelcomeMail(user *User) {
+	if err := SendEmailVerification(user); err != nil {
+		log.Printf("Failed to send verification mail to user %d: %v", user.ID, err)
+	}
+}
@@ -35,5 +35,5 @@ func OpenDatabaseConnection() {
 }
 
 func AutoMigrateModels() {
-	Database.AutoMigrate(&User{})
+	Database.AutoMigrate(&User{}, &AuditLog{}, &TokenFamily{}, &RefreshToken{}, &AccountToken{}, &RecoveryCode{})
 }
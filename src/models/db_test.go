@@ -0,0 +1,50 @@
+package models
+
+import (
+	"os"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDatabase подключается к базе TEST_POSTGRES_DSN, например
+// TEST_POSTGRES_DSN="host=localhost user=postgres password=postgres dbname=wamanga_test" go test ./src/models.
+// Без неё тесты с базой пропускаются. Таблицы создаются, но не очищаются: записи тестов
+// различаются случайными email.
+func openTestDatabase(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := Database
+	Database = db
+	t.Cleanup(func() { Database = previous })
+	AutoMigrateModels()
+
+	t.Setenv("JWT_SECRET_KEY", "test secret")
+	t.Setenv("JWT_PRIVATE_KEY", "")
+	t.Setenv("JWT_VERIFICATION_KEYS", "")
+	OpenSigningKeys()
+}
+
+// createTestUser создаёт пользователя с уникальным email
+func createTestUser(t *testing.T) *User {
+	t.Helper()
+	suffix, err := randomToken(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &User{Email: "reader-" + suffix + "@example.com", Username: "reader", Role: RoleReader}
+	if err := Database.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
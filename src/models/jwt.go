@@ -4,49 +4,72 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"main/src/utils"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v4"
 )
 
-var jwtKey = []byte("34r*#*FDEC") // Секретный ключ для подписи
-
 type Claims struct {
-	Id string `json:"id"`
-	jwt.StandardClaims
+	Id        string `json:"id"`
+	Role      Role   `json:"role"` // Для клиента; сервер проверяет права по роли из базы, см. AuthenticateToken
+	SessionID string `json:"sid"`  // Семейство токенов входа, см. TokenFamily
+	jwt.RegisteredClaims
+}
+
+// JWTIssuer - iss access токенов, переменная окружения JWT_ISSUER
+func JWTIssuer() string {
+	return utils.GetEnv("JWT_ISSUER", "wamanga")
+}
+
+// JWTAudience - aud access токенов, переменная окружения JWT_AUDIENCE. Сервисы, проверяющие токены
+// по JWKS, должны проверять и aud, чтобы не принять токен, выданный для другого получателя.
+func JWTAudience() string {
+	return utils.GetEnv("JWT_AUDIENCE", "wamanga-api")
 }
 
-// Функция для генерации JWT токена
-func GenerateJWT(id uint) (string, error) {
+// Функция для генерации JWT токена. Токен короткоживущий, новый выдаётся по refresh токену.
+func GenerateJWT(id uint, role Role, sessionID string) (string, error) {
 	// Время истечения срока действия токена
-	expirationTime := time.Now().Add(30 * 24 * time.Hour)
+	expirationTime := time.Now().Add(AccessTokenTTL())
 
 	// Создание объекта claims
 	claims := &Claims{
-		Id: fmt.Sprintf("%d", id), // Преобразуем id в строку
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(), // Время истечения
+		Id:        fmt.Sprintf("%d", id), // Преобразуем id в строку
+		Role:      role,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    JWTIssuer(),
+			Audience:  jwt.ClaimStrings{JWTAudience()},
+			ExpiresAt: jwt.NewNumericDate(expirationTime), // Время истечения
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	// Генерация токена с HMAC подписью
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	// Генерация токена, подписанного текущим ключом, см. OpenSigningKeys
+	token := jwt.NewWithClaims(currentKey.method, claims)
+	token.Header["kid"] = currentKey.id
+	tokenString, err := token.SignedString(currentKey.sign)
 
 	return tokenString, err
 }
 
 func DecodeToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
-	log.Println("JWT Key:", jwtKey)
 
-	// Парсинг токена
+	// Парсинг токена. Ключ выбирается по kid, а алгоритм должен совпадать с алгоритмом ключа,
+	// иначе открытый ключ RSA можно было бы выдать за секрет HMAC
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := verificationKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 
-		return jwtKey, nil
+		return key.verify, nil
 	})
 
 	// Обработка ошибок при парсинге токена
@@ -61,5 +84,10 @@ func DecodeToken(tokenString string) (*Claims, error) {
 		return nil, errors.New("invalid token")
 	}
 
+	// Токен должен быть выдан этим сервисом и для него, а не, например, токен второго шага входа
+	if !claims.VerifyIssuer(JWTIssuer(), true) || !claims.VerifyAudience(JWTAudience(), true) {
+		return nil, errors.New("token issuer or audience mismatch")
+	}
+
 	return claims, nil
 }
@@ -0,0 +1,247 @@
+package models
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// signingKey - ключ подписи или проверки JWT
+type signingKey struct {
+	id     string            // kid в заголовке токена
+	method jwt.SigningMethod // Единственный алгоритм, которым подписываются токены этого ключа
+	sign   interface{}       // Закрытый ключ или секрет HMAC, nil у ключей только для проверки
+	verify interface{}       // Открытый ключ или секрет HMAC
+}
+
+// Ключ, которым подписываются новые токены, и все ключи, которыми токены проверяются, по kid
+var (
+	currentKey       *signingKey
+	verificationKeys = map[string]*signingKey{}
+)
+
+// OpenSigningKeys загружает ключи JWT из переменных окружения:
+//   - JWT_PRIVATE_KEY - закрытый ключ RSA (RS256) или Ed25519 (EdDSA) в PEM: содержимое или путь к файлу;
+//   - JWT_SECRET_KEY - секрет HS256, если закрытый ключ не задан;
+//   - JWT_KEY_ID - kid ключа подписи, по умолчанию отпечаток ключа по RFC 7638;
+//   - JWT_VERIFICATION_KEYS - ключи прежних подписей через запятую: открытый ключ "путь" или "kid=путь",
+//     прежний секрет HS256 "hs256:секрет" или "kid=hs256:секрет".
+//
+// Токены, подписанные прежними ключами, принимаются, пока те перечислены в JWT_VERIFICATION_KEYS.
+// Без ключа подписи сервер не запускается: случайный ключ обрывал бы входы при каждом перезапуске
+// и не принимался бы другими экземплярами.
+func OpenSigningKeys() {
+	key, err := loadCurrentKey()
+	if err != nil {
+		panic(fmt.Errorf("failed to load JWT signing key: %w", err))
+	}
+	currentKey = key
+	verificationKeys = map[string]*signingKey{key.id: key}
+
+	for _, entry := range strings.Split(os.Getenv("JWT_VERIFICATION_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		// В секрете может быть "=" (base64), поэтому kid отделяется, только если секрет не идёт первым
+		id, source := "", entry
+		if before, after, found := strings.Cut(entry, "="); found && !strings.HasPrefix(entry, hmacKeyPrefix) {
+			id, source = before, after
+		}
+		key, err := loadVerificationKey(id, source)
+		if err != nil {
+			panic(fmt.Errorf("failed to load JWT verification key %q: %w", entry, err))
+		}
+		verificationKeys[key.id] = key
+	}
+}
+
+func loadCurrentKey() (*signingKey, error) {
+	if source := os.Getenv("JWT_PRIVATE_KEY"); source != "" {
+		block, err := readPEM(source)
+		if err != nil {
+			return nil, err
+		}
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			// Ключи RSA часто хранятся в формате PKCS #1 ("BEGIN RSA PRIVATE KEY")
+			if private, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+				return nil, err
+			}
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key type")
+		}
+		key, err := newAsymmetricKey(os.Getenv("JWT_KEY_ID"), signer.Public())
+		if err != nil {
+			return nil, err
+		}
+		key.sign = private
+		return key, nil
+	}
+
+	secret := os.Getenv("JWT_SECRET_KEY")
+	if secret == "" {
+		return nil, errors.New("JWT_PRIVATE_KEY or JWT_SECRET_KEY must be set")
+	}
+	return newSecretKey(os.Getenv("JWT_KEY_ID"), []byte(secret)), nil
+}
+
+// hmacKeyPrefix отмечает в JWT_VERIFICATION_KEYS прежний секрет HS256 вместо пути к открытому ключу
+const hmacKeyPrefix = "hs256:"
+
+// newSecretKey создаёт ключ HS256. Пустой id заменяется отпечатком секрета: он не раскрывает секрет,
+// но различает секреты при смене, поэтому прежний секрет без kid получает тот же kid, что и раньше.
+func newSecretKey(id string, secret []byte) *signingKey {
+	if id == "" {
+		sum := sha256.Sum256(secret)
+		id = "hs-" + base64.RawURLEncoding.EncodeToString(sum[:8])
+	}
+	return &signingKey{id: id, method: jwt.SigningMethodHS256, sign: secret, verify: secret}
+}
+
+func loadVerificationKey(id, source string) (*signingKey, error) {
+	if secret, ok := strings.CutPrefix(source, hmacKeyPrefix); ok {
+		if secret == "" {
+			return nil, errors.New("empty HS256 secret")
+		}
+		key := newSecretKey(id, []byte(secret))
+		// Прежним секретом только проверяют
+		key.sign = nil
+		return key, nil
+	}
+
+	block, err := readPEM(source)
+	if err != nil {
+		return nil, err
+	}
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		if public, err = x509.ParsePKCS1PublicKey(block.Bytes); err != nil {
+			return nil, err
+		}
+	}
+	return newAsymmetricKey(id, public)
+}
+
+// readPEM принимает PEM целиком или путь к файлу с ним
+func readPEM(source string) (*pem.Block, error) {
+	data := []byte(source)
+	if !strings.HasPrefix(strings.TrimSpace(source), "-----BEGIN") {
+		var err error
+		if data, err = os.ReadFile(source); err != nil {
+			return nil, err
+		}
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	return block, nil
+}
+
+// newAsymmetricKey определяет алгоритм по типу открытого ключа. Пустой id заменяется отпечатком ключа.
+func newAsymmetricKey(id string, public crypto.PublicKey) (*signingKey, error) {
+	key := &signingKey{id: id, verify: public}
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < 2048 {
+			return nil, errors.New("RSA key must be at least 2048 bits")
+		}
+		key.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", public)
+	}
+	if key.id == "" {
+		key.id = thumbprint(key.jwk())
+	}
+	return key, nil
+}
+
+// JWK - открытый ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet - набор открытых ключей для /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (key *signingKey) jwk() JWK {
+	jwk := JWK{Kid: key.id, Use: "sig", Alg: key.method.Alg()}
+	switch public := key.verify.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
+
+// thumbprint - отпечаток JWK по RFC 7638: SHA-256 от обязательных полей в лексикографическом порядке
+func thumbprint(jwk JWK) string {
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// PublicKeys возвращает открытые ключи подписи и проверки. Секреты HMAC не публикуются:
+// токены с HS256 могут проверить только экземпляры, которым известен JWT_SECRET_KEY.
+func PublicKeys() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	if currentKey != nil && currentKey.method != jwt.SigningMethodHS256 {
+		set.Keys = append(set.Keys, currentKey.jwk())
+	}
+	var previous []JWK
+	for _, key := range verificationKeys {
+		if key != currentKey && key.method != jwt.SigningMethodHS256 {
+			previous = append(previous, key.jwk())
+		}
+	}
+	sort.Slice(previous, func(i, j int) bool { return previous[i].Kid < previous[j].Kid })
+	set.Keys = append(set.Keys, previous...)
+	return set
+}
@@ -0,0 +1,214 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestThumbprint(t *testing.T) {
+	tests := []struct {
+		name string
+		jwk  JWK
+		want string
+	}{
+		{
+			// RFC 8037, приложение A.3
+			name: "Ed25519",
+			jwk:  JWK{Kty: "OKP", Crv: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo", Kid: "ignored", Alg: "EdDSA"},
+			want: "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := thumbprint(tt.jwk); got != tt.want {
+				t.Errorf("thumbprint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSecretKeyID(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		secret string
+		same   string // Секрет, kid которого должен совпасть
+		other  string // Секрет, kid которого должен отличаться
+	}{
+		{name: "derived from secret", secret: "first", same: "first", other: "second"},
+		{name: "explicit id", id: "2026-10", secret: "first"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := newSecretKey(tt.id, []byte(tt.secret))
+			if tt.id != "" && key.id != tt.id {
+				t.Errorf("kid = %q, want %q", key.id, tt.id)
+			}
+			if tt.same != "" && newSecretKey("", []byte(tt.same)).id != key.id {
+				t.Errorf("the same secret got a different kid")
+			}
+			if tt.other != "" && newSecretKey("", []byte(tt.other)).id == key.id {
+				t.Errorf("different secrets got the same kid %q", key.id)
+			}
+		})
+	}
+}
+
+// writeEd25519Key создаёт ключ Ed25519 и сохраняет закрытый и открытый ключи в PEM файлы
+func writeEd25519Key(t *testing.T, dir, name string) (ed25519.PrivateKey, string, string) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privatePath := filepath.Join(dir, name+".pem")
+	publicPath := filepath.Join(dir, name+".pub.pem")
+	if err := os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return private, privatePath, publicPath
+}
+
+// signTestToken подписывает access токен ключом key с заголовком kid
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims *Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func testClaims(issuer, audience string) *Claims {
+	return &Claims{
+		Id:        "1",
+		Role:      RoleReader,
+		SessionID: "session",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+}
+
+func TestDecodeTokenKeys(t *testing.T) {
+	dir := t.TempDir()
+	_, currentPath, _ := writeEd25519Key(t, dir, "current")
+	previous, _, previousPublic := writeEd25519Key(t, dir, "previous")
+
+	t.Setenv("JWT_PRIVATE_KEY", currentPath)
+	t.Setenv("JWT_SECRET_KEY", "")
+	t.Setenv("JWT_KEY_ID", "")
+	t.Setenv("JWT_VERIFICATION_KEYS", "old-ed="+previousPublic+", hs256:old=secret==, hs-old=hs256:older")
+	t.Setenv("JWT_ISSUER", "wamanga")
+	t.Setenv("JWT_AUDIENCE", "wamanga-api")
+	OpenSigningKeys()
+
+	current, err := GenerateJWT(1, RoleReader, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldSecret := newSecretKey("", []byte("old=secret=="))
+	publicJWK := currentKey.jwk()
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{name: "current key", token: current, valid: true},
+		{name: "previous Ed25519 key by kid", valid: true,
+			token: signTestToken(t, jwt.SigningMethodEdDSA, "old-ed", previous, testClaims("wamanga", "wamanga-api"))},
+		{name: "previous HS256 secret with derived kid", valid: true,
+			token: signTestToken(t, jwt.SigningMethodHS256, oldSecret.id, []byte("old=secret=="), testClaims("wamanga", "wamanga-api"))},
+		{name: "previous HS256 secret with explicit kid", valid: true,
+			token: signTestToken(t, jwt.SigningMethodHS256, "hs-old", []byte("older"), testClaims("wamanga", "wamanga-api"))},
+		{name: "previous key under another kid",
+			token: signTestToken(t, jwt.SigningMethodEdDSA, currentKey.id, previous, testClaims("wamanga", "wamanga-api"))},
+		{name: "unknown kid",
+			token: signTestToken(t, jwt.SigningMethodEdDSA, "unknown", previous, testClaims("wamanga", "wamanga-api"))},
+		{name: "no kid",
+			token: signTestToken(t, jwt.SigningMethodEdDSA, "", previous, testClaims("wamanga", "wamanga-api"))},
+		{name: "public key used as HMAC secret",
+			token: signTestToken(t, jwt.SigningMethodHS256, currentKey.id, []byte(publicJWK.X), testClaims("wamanga", "wamanga-api"))},
+		{name: "another issuer",
+			token: signTestToken(t, jwt.SigningMethodHS256, "hs-old", []byte("older"), testClaims("other", "wamanga-api"))},
+		{name: "another audience",
+			token: signTestToken(t, jwt.SigningMethodHS256, "hs-old", []byte("older"), testClaims("wamanga", "wamanga-login"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeToken(tt.token)
+			if (err == nil) != tt.valid {
+				t.Errorf("DecodeToken() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestPublicKeys(t *testing.T) {
+	dir := t.TempDir()
+	_, currentPath, _ := writeEd25519Key(t, dir, "current")
+	_, _, previousPublic := writeEd25519Key(t, dir, "previous")
+
+	t.Setenv("JWT_PRIVATE_KEY", currentPath)
+	t.Setenv("JWT_KEY_ID", "")
+	t.Setenv("JWT_VERIFICATION_KEYS", previousPublic+",hs256:old")
+	OpenSigningKeys()
+
+	set := PublicKeys()
+	if len(set.Keys) != 2 {
+		t.Fatalf("PublicKeys() has %d keys, want the current and the previous Ed25519 key", len(set.Keys))
+	}
+	if set.Keys[0].Kid != currentKey.id {
+		t.Errorf("first key %q, want the current key %q", set.Keys[0].Kid, currentKey.id)
+	}
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "OKP" || jwk.Alg != "EdDSA" {
+			t.Errorf("unexpected key %+v", jwk)
+		}
+		// kid по умолчанию - отпечаток, по которому ключ находится при проверке
+		if jwk.Kid != thumbprint(jwk) {
+			t.Errorf("kid %q is not the thumbprint %q", jwk.Kid, thumbprint(jwk))
+		}
+		if _, ok := verificationKeys[jwk.Kid]; !ok {
+			t.Errorf("published key %q is not used for verification", jwk.Kid)
+		}
+	}
+}
+
+func TestOpenSigningKeysRequiresKey(t *testing.T) {
+	t.Setenv("JWT_PRIVATE_KEY", "")
+	t.Setenv("JWT_SECRET_KEY", "")
+	defer func() {
+		if recover() == nil {
+			t.Error("OpenSigningKeys() did not fail without a signing key")
+		}
+	}()
+	OpenSigningKeys()
+}
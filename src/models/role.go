@@ -0,0 +1,126 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+type Role string
+type Permission string
+
+const (
+	RoleReader     Role = "reader"
+	RoleTranslator Role = "translator"
+	RoleModerator  Role = "moderator"
+	RoleAdmin      Role = "admin"
+)
+
+const (
+	PermComicsCreate     Permission = "comics:create"
+	PermComicsUpdate     Permission = "comics:update"
+	PermComicsDelete     Permission = "comics:delete"
+	PermComicsViewHidden Permission = "comics:view_hidden"
+	PermChaptersUpload   Permission = "chapters:upload"
+	PermChaptersDelete   Permission = "chapters:delete"
+	PermRevisionsRestore Permission = "revisions:restore"
+	PermUsersManage      Permission = "users:manage"
+	PermAuditView        Permission = "audit:view"
+	PermDuplicatesView   Permission = "duplicates:view"
+	PermUploadsCreate    Permission = "uploads:create"
+)
+
+// Права каждой роли. Старшие роли включают права младших.
+var rolePermissions = map[Role][]Permission{
+	RoleReader: {},
+	RoleTranslator: {
+		PermComicsCreate,
+		PermChaptersUpload,
+		PermUploadsCreate,
+	},
+	RoleModerator: {
+		PermComicsCreate,
+		PermChaptersUpload,
+		PermComicsUpdate,
+		PermComicsDelete,
+		PermComicsViewHidden,
+		PermChaptersDelete,
+		PermDuplicatesView,
+		PermUploadsCreate,
+	},
+	RoleAdmin: {
+		PermComicsCreate,
+		PermChaptersUpload,
+		PermComicsUpdate,
+		PermComicsDelete,
+		PermComicsViewHidden,
+		PermChaptersDelete,
+		PermRevisionsRestore,
+		PermUsersManage,
+		PermAuditView,
+		PermDuplicatesView,
+		PermUploadsCreate,
+	},
+}
+
+func (role Role) Valid() bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission проверяет, есть ли у роли указанное право
+func HasPermission(role Role, permission Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditLog - запись о запросе к маршруту, защищённому правами
+type AuditLog struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"index"`
+	Role       Role       `json:"role"`
+	Permission Permission `json:"permission"`
+	Method     string     `json:"method"`
+	Path       string     `json:"path"`
+	Status     int        `json:"status"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"index"`
+}
+
+func CreateAuditLog(entry *AuditLog) error {
+	return Database.Create(entry).Error
+}
+
+// GetAuditLogs возвращает записи аудита от новых к старым
+func GetAuditLogs(userID uint, limit, offset int) ([]AuditLog, error) {
+	logs := make([]AuditLog, 0, limit)
+	query := Database.Order("created_at DESC, id DESC").Limit(limit).Offset(offset)
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if err := query.Find(&logs).Error; err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// SetUserRole назначает пользователю роль
+func SetUserRole(id uint, role Role) (*User, error) {
+	if !role.Valid() {
+		return nil, errors.New("unknown role")
+	}
+
+	user, err := FetchUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Database.Model(user).Update("role", role).Error; err != nil {
+		return nil, err
+	}
+	user.Role = role
+	return user, nil
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// User-Agent длиннее этого обрезается при сохранении
+const maxUserAgentLength = 512
+
+// sessionTouchInterval - как часто обновляется время последнего запроса сессии,
+// чтобы не писать в базу на каждый запрос
+const sessionTouchInterval = time.Minute
+
+// SessionClient - устройство, с которого выполнен вход или обновление токенов
+type SessionClient struct {
+	UserAgent string
+	IP        string
+}
+
+// NewSessionClient описывает устройство запроса
+func NewSessionClient(userAgent, ip string) SessionClient {
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = strings.ToValidUTF8(userAgent[:maxUserAgentLength], "")
+	}
+	return SessionClient{UserAgent: userAgent, IP: ip}
+}
+
+// touchSession проверяет, что сессия access токена существует и не отозвана,
+// отмечает время последнего запроса и возвращает текущую роль владельца сессии.
+// Роль читается из базы на каждый запрос, поэтому понижение роли действует сразу,
+// а не после истечения уже выданных access токенов.
+func touchSession(sessionID string) (Role, error) {
+	if sessionID == "" {
+		return "", ErrTokenRevoked
+	}
+
+	var session struct {
+		TokenFamily
+		Role Role
+	}
+	err := Database.Model(&TokenFamily{}).
+		Select("token_families.id, token_families.user_id, token_families.revoked_at, token_families.last_seen_at, users.role").
+		Joins("JOIN users ON users.id = token_families.user_id").
+		Where("token_families.id = ?", sessionID).
+		Limit(1).
+		Scan(&session).Error
+	if err != nil {
+		return "", err
+	}
+	// Сессии нет или её пользователь удалён
+	if session.ID == "" || session.RevokedAt != nil {
+		return "", ErrTokenRevoked
+	}
+
+	if time.Since(session.LastSeenAt) > sessionTouchInterval {
+		err := Database.Model(&TokenFamily{}).Where("id = ?", session.ID).UpdateColumn("last_seen_at", time.Now()).Error
+		if err != nil {
+			return "", err
+		}
+	}
+	return session.Role, nil
+}
+
+// GetSessions возвращает действующие сессии пользователя, начиная с последней активной.
+// Сессия действует, пока не отозвана и у неё есть неиспользованный непросроченный refresh токен.
+func GetSessions(userID uint, currentID string) ([]TokenFamily, error) {
+	var sessions []TokenFamily
+	err := Database.
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Where("EXISTS (SELECT 1 FROM refresh_tokens WHERE refresh_tokens.family_id = token_families.id AND refresh_tokens.used_at IS NULL AND refresh_tokens.expires_at > ?)", time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+	return sessions, nil
+}
+
+// RevokeSession завершает сессию пользователя. Чужие сессии не отличаются от несуществующих.
+func RevokeSession(userID uint, sessionID string) error {
+	var family TokenFamily
+	err := Database.Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).First(&family).Error
+	if err != nil {
+		return err
+	}
+	return RevokeTokenFamily(family.ID)
+}
+
+// Признаки систем и браузеров в User-Agent. Порядок важен: Android содержит "Linux",
+// Edge и Opera - "Chrome", а Chrome - "Safari".
+var (
+	deviceSystems = []struct{ marker, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+	deviceBrowsers = []struct{ marker, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"YaBrowser/", "Yandex Browser"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	}
+)
+
+// describeDevice кратко описывает устройство по User-Agent, например "Firefox, Windows"
+func describeDevice(userAgent string) string {
+	var parts []string
+	for _, browser := range deviceBrowsers {
+		if strings.Contains(userAgent, browser.marker) {
+			parts = append(parts, browser.name)
+			break
+		}
+	}
+	for _, system := range deviceSystems {
+		if strings.Contains(userAgent, system.marker) {
+			parts = append(parts, system.name)
+			break
+		}
+	}
+	if len(parts) == 0 {
+		// Приложения и библиотеки обычно начинают User-Agent со своего имени
+		if name, _, _ := strings.Cut(userAgent, " "); name != "" {
+			return name
+		}
+		return "Unknown device"
+	}
+	return strings.Join(parts, ", ")
+}
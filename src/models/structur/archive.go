@@ -0,0 +1,167 @@
+package structur
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"main/src/comicinfo"
+	"main/src/storage"
+	"main/src/utils"
+	"path"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Максимальный размер одной страницы в распакованном виде
+const maxArchivePageSize = 50 << 20
+
+// Расширения файлов архива, которые считаются страницами
+var archivePageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".webp": true,
+}
+
+// archivePages возвращает файлы страниц архива, отсортированные в естественном порядке
+func archivePages(reader *zip.Reader) []*zip.File {
+	var files []*zip.File
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() || strings.HasPrefix(file.Name, "__MACOSX/") {
+			continue
+		}
+		name := path.Base(file.Name)
+		if strings.HasPrefix(name, ".") || !archivePageExtensions[strings.ToLower(path.Ext(name))] {
+			continue
+		}
+		files = append(files, file)
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return utils.NaturalLess(files[i].Name, files[j].Name)
+	})
+	return files
+}
+
+// archiveComicInfo читает ComicInfo.xml из архива, если он там есть
+func archiveComicInfo(reader *zip.Reader) (*comicinfo.ComicInfo, error) {
+	for _, file := range reader.File {
+		if !strings.EqualFold(path.Base(file.Name), comicinfo.FileName) || strings.HasPrefix(file.Name, "__MACOSX/") {
+			continue
+		}
+
+		stream, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name, err)
+		}
+		defer stream.Close()
+
+		return comicinfo.Parse(io.LimitReader(stream, 1<<20))
+	}
+	return nil, nil
+}
+
+// ImportChapterArchive создаёт главу из CBZ/ZIP архива. Изображения архива становятся страницами
+// в естественном порядке имён файлов. Импорт выполняется целиком или не выполняется вовсе.
+// Если в архиве есть ComicInfo.xml, из него заполняются пустые поля главы и комикса;
+// отрицательный номер главы означает, что номер берётся из ComicInfo.xml.
+// Изменения комикса записываются в ревизию от имени userID.
+func ImportChapterArchive(comic *Comics, chapter *Chapter, archive io.ReaderAt, size int64, userID uint) (*Chapter, error) {
+	reader, err := zip.NewReader(archive, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+
+	info, err := archiveComicInfo(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *comic
+	var comicUpdates map[string]interface{}
+	if info != nil {
+		comicUpdates = ApplyComicInfo(comic, chapter, info)
+	}
+
+	// Номер не задан ни в запросе, ни в ComicInfo.xml: глава идёт следующей за последней
+	if chapter.Number < 0 {
+		chapter.Number, err = NextChapterNumber(comic.ID, chapter.Language)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	files := archivePages(reader)
+	if len(files) == 0 {
+		return nil, errors.New("archive does not contain any images")
+	}
+
+	pages := make([]io.Reader, 0, len(files))
+	for _, file := range files {
+		if file.UncompressedSize64 > maxArchivePageSize {
+			return nil, fmt.Errorf("%s: page is too large", file.Name)
+		}
+
+		stream, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name, err)
+		}
+		defer stream.Close()
+
+		// Ограничиваем чтение на случай, если заголовок архива врёт о размере
+		pages = append(pages, io.LimitReader(stream, maxArchivePageSize))
+	}
+
+	return createChapter(comic, chapter, pages, func(tx *gorm.DB) error {
+		if len(comicUpdates) == 0 {
+			return nil
+		}
+		comicUpdates["version"] = gorm.Expr("version + 1")
+		if err := tx.Model(comic).Updates(comicUpdates).Error; err != nil {
+			return err
+		}
+		if err := tx.First(comic, comic.ID).Error; err != nil {
+			return err
+		}
+		return recordRevision(tx, &before, comic, userID, nil)
+	})
+}
+
+// ExportChapterArchive записывает главу в CBZ архив вместе с ComicInfo.xml
+func ExportChapterArchive(comic *Comics, chapter *Chapter, w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	for i, page := range chapter.Pages {
+		source, err := storage.Default.Open(page.FilePath)
+		if err != nil {
+			return fmt.Errorf("page %d: %w", page.Order, err)
+		}
+
+		// Изображения уже сжаты, поэтому кладём их без компрессии
+		entry, err := archive.CreateHeader(&zip.FileHeader{
+			Name:   fmt.Sprintf("%03d%s", i+1, path.Ext(page.FilePath)),
+			Method: zip.Store,
+		})
+		if err == nil {
+			_, err = io.Copy(entry, source)
+		}
+		source.Close()
+		if err != nil {
+			return fmt.Errorf("page %d: %w", page.Order, err)
+		}
+	}
+
+	entry, err := archive.Create(comicinfo.FileName)
+	if err != nil {
+		return err
+	}
+	if err := comicinfo.Write(entry, ComicInfoFor(comic, chapter)); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
@@ -0,0 +1,200 @@
+package structur
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"main/src/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	DefaultCatalogLimit = 20
+	MaxCatalogLimit     = 100
+)
+
+// Колонки, по которым разрешена сортировка каталога
+var catalogSortColumns = map[string]string{
+	"rating":       "rating",
+	"views":        "views",
+	"likes":        "likes",
+	"updated_at":   "updated_at",
+	"published_on": "published_on",
+}
+
+type CatalogFilter struct {
+	Types         []ComicsType
+	Statuses      []StatusType
+	Pegi          []PegiType
+	YearFrom      int
+	YearTo        int
+	IsFinished    *bool
+	Genres        []string // Комикс должен содержать все перечисленные жанры
+	ExcludeGenres []string // Комикс не должен содержать ни одного из жанров
+	Tags          []string
+	ExcludeTags   []string
+	Sort          string
+	Ascending     bool
+	Limit         int
+	Cursor        string
+	IncludeHidden bool
+}
+
+type CatalogPage struct {
+	Items      []Comics `json:"items"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// catalogCursor - позиция в выдаче: значение колонки сортировки и id последнего комикса
+type catalogCursor struct {
+	Value json.RawMessage `json:"v"`
+	ID    uint            `json:"id"`
+}
+
+func encodeCatalogCursor(comic *Comics, sort string) (string, error) {
+	var value interface{}
+	switch sort {
+	case "rating":
+		value = comic.Rating
+	case "views":
+		value = comic.Views
+	case "likes":
+		value = comic.Likes
+	case "updated_at":
+		value = comic.UpdatedAt
+	case "published_on":
+		value = comic.PublishedOn
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(catalogCursor{Value: raw, ID: comic.ID})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCatalogCursor возвращает значение колонки сортировки в типе этой колонки и id
+func decodeCatalogCursor(cursor, sort string) (interface{}, uint, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, 0, errors.New("invalid cursor")
+	}
+	var decoded catalogCursor
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, 0, errors.New("invalid cursor")
+	}
+
+	var value interface{}
+	switch sort {
+	case "rating":
+		var rating float32
+		err = json.Unmarshal(decoded.Value, &rating)
+		value = float64(rating)
+	case "views", "likes":
+		var count int32
+		err = json.Unmarshal(decoded.Value, &count)
+		value = count
+	default:
+		var date time.Time
+		err = json.Unmarshal(decoded.Value, &date)
+		value = date
+	}
+	if err != nil {
+		return nil, 0, errors.New("cursor does not match sort order")
+	}
+	return value, decoded.ID, nil
+}
+
+// ListComics возвращает страницу каталога с фильтрацией, сортировкой и курсорной пагинацией
+func ListComics(filter CatalogFilter) (*CatalogPage, error) {
+	if filter.Sort == "" {
+		filter.Sort = "updated_at"
+	}
+	column, ok := catalogSortColumns[filter.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sort %q", filter.Sort)
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultCatalogLimit
+	}
+	if filter.Limit > MaxCatalogLimit {
+		filter.Limit = MaxCatalogLimit
+	}
+
+	query := models.Database.Model(&Comics{})
+	if !filter.IncludeHidden {
+		query = query.Where("hidden = ?", false)
+	}
+	if len(filter.Types) > 0 {
+		query = query.Where("type IN ?", filter.Types)
+	}
+	if len(filter.Statuses) > 0 {
+		query = query.Where("status IN ?", filter.Statuses)
+	}
+	if len(filter.Pegi) > 0 {
+		query = query.Where("pegi IN ?", filter.Pegi)
+	}
+	if filter.YearFrom > 0 {
+		query = query.Where("year >= ?", filter.YearFrom)
+	}
+	if filter.YearTo > 0 {
+		query = query.Where("year <= ?", filter.YearTo)
+	}
+	if filter.IsFinished != nil {
+		query = query.Where("is_finished = ?", *filter.IsFinished)
+	}
+	if len(filter.Genres) > 0 {
+		query = query.Where("genres @> ?::text[]", pq.StringArray(filter.Genres))
+	}
+	if len(filter.ExcludeGenres) > 0 {
+		query = query.Where("NOT (COALESCE(genres, '{}') && ?::text[])", pq.StringArray(filter.ExcludeGenres))
+	}
+	if len(filter.Tags) > 0 {
+		query = query.Where("tags @> ?::text[]", pq.StringArray(filter.Tags))
+	}
+	if len(filter.ExcludeTags) > 0 {
+		query = query.Where("NOT (COALESCE(tags, '{}') && ?::text[])", pq.StringArray(filter.ExcludeTags))
+	}
+
+	direction, operator := "DESC", "<"
+	if filter.Ascending {
+		direction, operator = "ASC", ">"
+	}
+
+	if filter.Cursor != "" {
+		value, id, err := decodeCatalogCursor(filter.Cursor, filter.Sort)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(
+			fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, operator),
+			value, value, id,
+		)
+	}
+
+	comics := make([]Comics, 0, filter.Limit+1)
+	err := query.
+		Order(fmt.Sprintf("%s %s, id %s", column, direction, direction)).
+		Limit(filter.Limit + 1).
+		Find(&comics).Error
+	if err != nil {
+		return nil, err
+	}
+
+	page := &CatalogPage{Items: comics}
+	if len(comics) > filter.Limit {
+		page.Items = comics[:filter.Limit]
+		page.NextCursor, err = encodeCatalogCursor(&page.Items[filter.Limit-1], filter.Sort)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
@@ -0,0 +1,88 @@
+package structur
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestCatalogCursorRoundTrip(t *testing.T) {
+	updated := time.Date(2024, 3, 1, 12, 30, 15, 123456000, time.UTC)
+	comic := Comics{ID: 42, Rating: 4.75, Views: 1500, Likes: 30, UpdatedAt: updated, PublishedOn: updated.AddDate(-1, 0, 0)}
+
+	tests := []struct {
+		sort string
+		want interface{}
+	}{
+		{sort: "rating", want: 4.75},
+		{sort: "views", want: int32(1500)},
+		{sort: "likes", want: int32(30)},
+		{sort: "updated_at", want: updated},
+		{sort: "published_on", want: updated.AddDate(-1, 0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			cursor, err := encodeCatalogCursor(&comic, tt.sort)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value, id, err := decodeCatalogCursor(cursor, tt.sort)
+			if err != nil {
+				t.Fatalf("decodeCatalogCursor() error = %v", err)
+			}
+			if id != comic.ID {
+				t.Errorf("id = %d, want %d", id, comic.ID)
+			}
+			if date, ok := tt.want.(time.Time); ok {
+				if got, ok := value.(time.Time); !ok || !got.Equal(date) {
+					t.Errorf("value = %v, want %v", value, date)
+				}
+				return
+			}
+			if value != tt.want {
+				t.Errorf("value = %#v, want %#v", value, tt.want)
+			}
+		})
+	}
+}
+
+func TestCatalogCursorInvalid(t *testing.T) {
+	comic := Comics{ID: 7, Rating: 3.5, Views: 10}
+	rating, err := encodeCatalogCursor(&comic, "rating")
+	if err != nil {
+		t.Fatal(err)
+	}
+	views, err := encodeCatalogCursor(&comic, "views")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(payload string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(payload))
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+		sort   string
+		want   string
+	}{
+		{name: "not base64", cursor: "!!!", sort: "rating", want: "invalid cursor"},
+		{name: "padded base64", cursor: base64.URLEncoding.EncodeToString([]byte(`{"v":1,"id":1}`)), sort: "rating", want: "invalid cursor"},
+		{name: "not json", cursor: encode("rating=1"), sort: "rating", want: "invalid cursor"},
+		{name: "truncated", cursor: rating[:len(rating)-4], sort: "rating", want: "invalid cursor"},
+		{name: "string instead of number", cursor: encode(`{"v":"1 OR 1=1","id":7}`), sort: "rating", want: "cursor does not match sort order"},
+		{name: "date cursor for views", cursor: encode(`{"v":"2024-03-01T00:00:00Z","id":7}`), sort: "views", want: "cursor does not match sort order"},
+		{name: "rating cursor for views", cursor: rating, sort: "views", want: "cursor does not match sort order"},
+		{name: "views cursor for updated_at", cursor: views, sort: "updated_at", want: "cursor does not match sort order"},
+		{name: "views out of range", cursor: encode(`{"v":4294967296,"id":7}`), sort: "views", want: "cursor does not match sort order"},
+		{name: "negative id", cursor: encode(`{"v":1,"id":-1}`), sort: "views", want: "invalid cursor"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := decodeCatalogCursor(tt.cursor, tt.sort)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("decodeCatalogCursor() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package structur
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"main/src/imaging"
+	"main/src/models"
+	"main/src/storage"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Chapter struct {
+	ID             uint        `json:"id" gorm:"primaryKey"`
+	ComicsID       uint        `json:"comics_id" gorm:"uniqueIndex:idx_chapter_number"`
+	Volume         int         `json:"volume"`
+	Number         float64     `json:"number" gorm:"type:numeric(10,2);uniqueIndex:idx_chapter_number"` // Номер главы, допускаются дробные (12.5)
+	Title          string      `json:"title"`
+	Language       string      `json:"language" gorm:"uniqueIndex:idx_chapter_number"`
+	TranslatorTeam string      `json:"translator_team"`
+	Position       int         `json:"position"` // Порядок отображения главы в списке
+	PublishedAt    time.Time   `json:"published_at"`
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+	Pages          []Page      `json:"pages,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+	Duplicates     []Duplicate `json:"duplicates,omitempty" gorm:"-"` // Главы с теми же страницами, найденные при загрузке
+	ExportURL      string      `json:"export_url,omitempty" gorm:"-"` // Подписанный адрес скачивания главы CBZ архивом
+}
+
+type Page struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	ChapterID   uint   `json:"chapter_id" gorm:"index"`
+	Order       int    `json:"order" gorm:"column:page_order"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	FilePath    string `json:"-"`                                              // Ключ страницы в хранилище
+	Hash        *int64 `json:"-"`                                              // Перцептивный хэш страницы для поиска дубликатов
+	HashChecked bool   `json:"-" gorm:"not null;default:false"`                // Хэш вычислен командой hash-images, даже если не сохранён
+	Broken      bool   `json:"broken,omitempty" gorm:"not null;default:false"` // Файл страницы не найден в хранилище, см. check-storage
+	URL         string `json:"url" gorm:"-"`                                   // Подписанный адрес страницы, действует PageURLTTL
+}
+
+// AfterFind заполняет подписанный адрес страницы по ключу хранилища.
+// Адрес для конкретного читателя выдаёт Chapter.SignPages.
+func (page *Page) AfterFind(tx *gorm.DB) error {
+	page.URL = pageURL(page.FilePath, 0)
+	return nil
+}
+
+func (page *Page) AfterCreate(tx *gorm.DB) error {
+	page.URL = pageURL(page.FilePath, 0)
+	return nil
+}
+
+// Расширения файлов для поддерживаемых MIME типов страниц
+var pageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// chapterPrefix возвращает префикс ключей страниц главы в хранилище
+func chapterPrefix(alternativeName string, chapterID uint) string {
+	return storage.Key(alternativeName, "chapters", fmt.Sprintf("%d", chapterID))
+}
+
+// GetComicsBySlug ищет комикс по альтернативному имени (slug)
+func GetComicsBySlug(slug string) (*Comics, error) {
+	var comics Comics
+	err := models.Database.Where("alternative_name = ?", slug).First(&comics).Error
+	if err != nil {
+		return nil, err
+	}
+	return &comics, nil
+}
+
+// NextChapterNumber возвращает номер, следующий за последней главой комикса на языке language:
+// целую часть наибольшего номера плюс один, для комикса без глав - 1
+func NextChapterNumber(comicsID uint, language string) (float64, error) {
+	var last float64
+	err := models.Database.Model(&Chapter{}).
+		Where("comics_id = ? AND language = ?", comicsID, language).
+		Select("COALESCE(MAX(number), 0)").
+		Scan(&last).Error
+	if err != nil {
+		return 0, err
+	}
+	return math.Floor(last) + 1, nil
+}
+
+func GetChapters(comicsID uint) ([]Chapter, error) {
+	var chapters []Chapter
+	err := models.Database.Where("comics_id = ?", comicsID).
+		Order("position, volume, number").
+		Find(&chapters).Error
+	if err != nil {
+		return nil, err
+	}
+	return chapters, nil
+}
+
+func GetChapter(comicsID, chapterID uint) (*Chapter, error) {
+	var chapter Chapter
+	err := models.Database.
+		Preload("Pages", func(db *gorm.DB) *gorm.DB { return db.Order("page_order") }).
+		Where("comics_id = ? AND id = ?", comicsID, chapterID).
+		First(&chapter).Error
+	if err != nil {
+		return nil, err
+	}
+	return &chapter, nil
+}
+
+// CreateChapter сохраняет главу и её страницы. Страницы записываются в порядке следования pages.
+// При любой ошибке запись в базе откатывается, а уже сохранённые файлы удаляются.
+func CreateChapter(comic *Comics, chapter *Chapter, pages []io.Reader) (*Chapter, error) {
+	return createChapter(comic, chapter, pages, nil)
+}
+
+// createChapter - реализация CreateChapter. beforeCommit, если задан, выполняется
+// в той же транзакции после сохранения страниц.
+func createChapter(comic *Comics, chapter *Chapter, pages []io.Reader, beforeCommit func(tx *gorm.DB) error) (*Chapter, error) {
+	if chapter.Number < 0 {
+		return nil, errors.New("chapter number is required")
+	}
+
+	chapter.ComicsID = comic.ID
+	if chapter.PublishedAt.IsZero() {
+		chapter.PublishedAt = time.Now()
+	}
+
+	// Страницы проверяются, а страницы вебтунов нарезаются, склеиваются и кодируются
+	// до начала транзакции, чтобы не держать её открытой на время обработки изображений
+	writer := newPageWriter(comic, len(pages))
+	var validation ValidationError
+	for i, stream := range pages {
+		data, err := io.ReadAll(io.LimitReader(stream, int64(imaging.PageLimits.MaxBytes)+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read page %d: %w", i+1, err)
+		}
+
+		// Страницы обычно хранятся без перекодирования, поэтому проверяются так же строго, как обложки
+		info, img, err := imaging.Inspect(data, imaging.PageLimits)
+		if imaging.IsInvalidImage(err) {
+			validation.add(fmt.Sprintf("pages[%d]", i), err.Error())
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", i+1, err)
+		}
+		if len(validation.Fields) > 0 {
+			// Остальные страницы только проверяем, чтобы вернуть все ошибки сразу
+			continue
+		}
+
+		if err := writer.add(uploadedPage{data: data, info: info, img: img}); err != nil {
+			return nil, err
+		}
+	}
+	if len(validation.Fields) > 0 {
+		return nil, &validation
+	}
+	if err := writer.flush(); err != nil {
+		return nil, err
+	}
+
+	var prefix string
+	err := models.Database.Transaction(func(tx *gorm.DB) error {
+		var existing Chapter
+		err := tx.Where("comics_id = ? AND number = ? AND language = ?", comic.ID, chapter.Number, chapter.Language).First(&existing).Error
+		if err == nil {
+			return errors.New("a chapter with the same number already exists")
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("failed to check existing chapter: %w", err)
+		}
+
+		// Новая глава добавляется в конец списка
+		var maxPosition int
+		if err := tx.Model(&Chapter{}).Where("comics_id = ?", comic.ID).Select("COALESCE(MAX(position), 0)").Scan(&maxPosition).Error; err != nil {
+			return err
+		}
+		chapter.Position = maxPosition + 1
+
+		if err := tx.Omit("Pages").Create(chapter).Error; err != nil {
+			return err
+		}
+
+		prefix = chapterPrefix(comic.AlternativeName, chapter.ID)
+		chapter.Pages, err = writer.save(prefix, chapter.ID)
+		if err != nil {
+			return err
+		}
+
+		chapter.Duplicates, err = checkDuplicates("chapter", func(threshold int) ([]Duplicate, error) {
+			return findChapterDuplicates(tx, writer.hashes(), chapter.ID, threshold)
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(chapter.Pages) > 0 {
+			if err := tx.Create(&chapter.Pages).Error; err != nil {
+				return err
+			}
+		}
+
+		if beforeCommit != nil {
+			return beforeCommit(tx)
+		}
+		return nil
+	})
+
+	if err != nil {
+		if prefix != "" {
+			if removeErr := storage.Default.DeletePrefix(prefix); removeErr != nil {
+				log.Printf("Failed to clean up chapter pages %s: %v", prefix, removeErr)
+			}
+		}
+		return nil, err
+	}
+	return chapter, nil
+}
+
+// ReorderChapters выставляет позиции глав комикса в порядке следования ids
+func ReorderChapters(comicsID uint, ids []uint) ([]Chapter, error) {
+	err := models.Database.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Chapter{}).Where("comics_id = ?", comicsID).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(ids) {
+			return errors.New("chapter list must contain every chapter of the comic exactly once")
+		}
+
+		seen := make(map[uint]bool, len(ids))
+		for i, id := range ids {
+			if seen[id] {
+				return fmt.Errorf("chapter %d is listed more than once", id)
+			}
+			seen[id] = true
+
+			result := tx.Model(&Chapter{}).Where("comics_id = ? AND id = ?", comicsID, id).Update("position", i+1)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return fmt.Errorf("chapter %d not found", id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetChapters(comicsID)
+}
+
+func DeleteChapter(comic *Comics, chapterID uint) (*Chapter, error) {
+	chapter, err := GetChapter(comic.ID, chapterID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = models.Database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("chapter_id = ?", chapter.ID).Delete(&Page{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Chapter{}, chapter.ID).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete chapter: %w", err)
+	}
+
+	// Удаление страниц главы из хранилища
+	if err := storage.Default.DeletePrefix(chapterPrefix(comic.AlternativeName, chapter.ID)); err != nil {
+		return nil, fmt.Errorf("failed to delete chapter pages: %w", err)
+	}
+
+	return chapter, nil
+}
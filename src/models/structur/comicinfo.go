@@ -0,0 +1,158 @@
+package structur
+
+import (
+	"main/src/comicinfo"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Соответствие возрастных рейтингов ComicInfo нашим
+var ageRatingToPegi = map[string]PegiType{
+	"everyone":        Pegi3,
+	"g":               Pegi3,
+	"kids to adults":  Pegi6,
+	"everyone 10+":    Pegi12,
+	"pg":              Pegi12,
+	"teen":            Pegi12,
+	"ma15+":           Pegi16,
+	"mature 17+":      Pegi16,
+	"m":               Pegi16,
+	"r18+":            Pegi18,
+	"adults only 18+": Pegi18,
+	"x18+":            Pegi18,
+}
+
+var pegiToAgeRating = map[PegiType]string{
+	Pegi3:  "Everyone",
+	Pegi6:  "Kids to Adults",
+	Pegi12: "Teen",
+	Pegi16: "MA15+",
+	Pegi18: "Adults Only 18+",
+}
+
+// ApplyComicInfo заполняет пустые поля комикса и главы из ComicInfo.xml.
+// Уже заданные значения не перезаписываются. Возвращает изменённые колонки комикса.
+func ApplyComicInfo(comic *Comics, chapter *Chapter, info *comicinfo.ComicInfo) map[string]interface{} {
+	updated := map[string]interface{}{}
+
+	if comic.Name == "" && info.Series != "" {
+		comic.Name = info.Series
+		updated["name"] = comic.Name
+	}
+	if comic.Author == "" && info.Writer != "" {
+		comic.Author = info.Writer
+		updated["author"] = comic.Author
+	}
+	if comic.Artist == "" && info.Penciller != "" {
+		comic.Artist = info.Penciller
+		updated["artist"] = comic.Artist
+	}
+	if comic.Year == 0 && info.Year > 0 {
+		comic.Year = info.Year
+		updated["year"] = comic.Year
+	}
+	if comic.Description == "" && info.Summary != "" {
+		comic.Description = info.Summary
+		updated["description"] = comic.Description
+	}
+	if len(comic.Genres) == 0 && info.Genre != "" {
+		comic.Genres = pq.StringArray(comicinfo.SplitList(info.Genre))
+		updated["genres"] = comic.Genres
+	}
+	if len(comic.Tags) == 0 && info.Tags != "" {
+		comic.Tags = pq.StringArray(comicinfo.SplitList(info.Tags))
+		updated["tags"] = comic.Tags
+	}
+	if comic.Pegi == "" {
+		if pegi, ok := ageRatingToPegi[strings.ToLower(info.AgeRating)]; ok {
+			comic.Pegi = pegi
+			updated["pegi"] = comic.Pegi
+		}
+	}
+	if comic.Type == "" && info.Manga == comicinfo.MangaYesAndRightToLeft {
+		comic.Type = Manga
+		updated["type"] = comic.Type
+	}
+
+	if chapter != nil {
+		if chapter.Number < 0 {
+			if number, err := strconv.ParseFloat(strings.TrimSpace(info.Number), 64); err == nil && number >= 0 {
+				chapter.Number = number
+			}
+		}
+		if chapter.Title == "" {
+			chapter.Title = info.Title
+		}
+		if chapter.Volume == 0 && info.Volume > 0 {
+			chapter.Volume = info.Volume
+		}
+		if chapter.Language == "" {
+			chapter.Language = info.LanguageISO
+		}
+		if chapter.TranslatorTeam == "" {
+			chapter.TranslatorTeam = info.Translator
+		}
+		if chapter.PublishedAt.IsZero() && info.Year > 0 {
+			month, day := max(info.Month, 1), max(info.Day, 1)
+			chapter.PublishedAt = time.Date(info.Year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+		}
+	}
+
+	return updated
+}
+
+// ComicInfoFor собирает ComicInfo.xml для экспорта главы комикса
+func ComicInfoFor(comic *Comics, chapter *Chapter) *comicinfo.ComicInfo {
+	info := &comicinfo.ComicInfo{
+		Series:          comic.Name,
+		AlternateSeries: comic.AlternativeName,
+		Summary:         comic.Description,
+		Writer:          comic.Author,
+		Penciller:       comic.Artist,
+		Genre:           comicinfo.JoinList(comic.Genres),
+		Tags:            comicinfo.JoinList(comic.Tags),
+		AgeRating:       pegiToAgeRating[comic.Pegi],
+		CommunityRating: comic.Rating,
+		Manga:           comicinfo.MangaNo,
+	}
+
+	switch comic.Type {
+	case Manga:
+		info.Manga = comicinfo.MangaYesAndRightToLeft
+	case Manhva:
+		info.Manga = comicinfo.MangaYes
+	}
+
+	if chapter == nil {
+		info.Year = comic.Year
+		return info
+	}
+
+	info.Title = chapter.Title
+	info.Number = strconv.FormatFloat(chapter.Number, 'f', -1, 64)
+	info.Volume = chapter.Volume
+	info.LanguageISO = chapter.Language
+	info.Translator = chapter.TranslatorTeam
+	if !chapter.PublishedAt.IsZero() {
+		info.Year = chapter.PublishedAt.Year()
+		info.Month = int(chapter.PublishedAt.Month())
+		info.Day = chapter.PublishedAt.Day()
+	}
+
+	if len(chapter.Pages) > 0 {
+		info.PageCount = len(chapter.Pages)
+		info.Pages = &comicinfo.Pages{}
+		for i, page := range chapter.Pages {
+			info.Pages.Page = append(info.Pages.Page, comicinfo.Page{
+				Image:       i,
+				ImageWidth:  page.Width,
+				ImageHeight: page.Height,
+			})
+		}
+		info.Pages.Page[0].Type = "FrontCover"
+	}
+	return info
+}
@@ -1,16 +1,21 @@
 package structur
 
 import (
+	"bytes"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"github.com/gosimple/slug"
 	"github.com/lib/pq"
 	"gorm.io/gorm"
+	"image"
 	"io"
 	"log"
+	"main/src/imaging"
 	"main/src/models"
-	"os"
-	"path/filepath"
+	"main/src/storage"
+	"path"
+	"strings"
 	"time"
 )
 
@@ -49,29 +54,72 @@ const (
 
 // TODO: я хз похуй мне на это
 type Comics struct {
-	ID              uint           `json:"id" gorm:"primaryKey"`
-	Name            string         `json:"name" `
-	AlternativeName string         `json:"alternative_name" ` // Необязательное поле
-	Description     string         `json:"description" `
-	Rating          float32        `json:"rating" `
-	ImagePath       string         `json:"image_path" `
-	BannerPath      string         `json:"banner_path" `
-	Type            ComicsType     `json:"type_comics" `
-	Author          string         `json:"author" `
-	Artist          string         `json:"original_author" `
-	Year            int            `json:"year" `
-	IsFinished      bool           `json:"is_finished" `
-	Pegi            PegiType       `json:"pegi" `
-	Status          StatusType     `json:"status" `
-	TransferStatus  StatusType     `json:"transfer_status" `
-	Views           int32          `json:"views" `
-	Likes           int32          `json:"likes" `
-	Hidden          bool           `json:"hidden" `
-	PublishedOn     time.Time      `json:"published_on"` // Необязательное поле
-	UpdatedAt       time.Time      `json:"updated_at"`   // Необязательное поле
-	Tags            pq.StringArray `json:"tags" gorm:"type:text[]" swaggertype:"array,string" `
-	Genres          pq.StringArray `json:"genres" gorm:"type:text[]" swaggertype:"array,string" `
-	Bookmark        int            `json:"bookmark"`
+	ID               uint             `json:"id" gorm:"primaryKey"`
+	Name             string           `json:"name" `
+	AlternativeName  string           `json:"alternative_name" ` // Необязательное поле
+	Description      string           `json:"description" `
+	Rating           float32          `json:"rating" `
+	ImagePath        string           `json:"-"`                                 // Ключ обложки в хранилище
+	BannerPath       string           `json:"-"`                                 // Ключ баннера в хранилище
+	ImageURL         string           `json:"image_url" gorm:"-"`                // Публичный адрес обложки
+	BannerURL        string           `json:"banner_url" gorm:"-"`               // Публичный адрес баннера
+	ImageVariants    imaging.Variants `json:"image_variants" gorm:"type:jsonb"`  // Уменьшенные копии обложки для srcset
+	BannerVariants   imaging.Variants `json:"banner_variants" gorm:"type:jsonb"` // Уменьшенные копии баннера для srcset
+	ImageHash        *int64           `json:"-"`                                 // Перцептивный хэш обложки для поиска дубликатов
+	ImageHashChecked bool             `json:"-" gorm:"not null;default:false"`   // Хэш вычислен командой hash-images, даже если не сохранён
+	Type             ComicsType       `json:"type_comics" `
+	Author           string           `json:"author" `
+	Artist           string           `json:"original_author" `
+	Year             int              `json:"year" `
+	IsFinished       bool             `json:"is_finished" `
+	Pegi             PegiType         `json:"pegi" `
+	Status           StatusType       `json:"status" `
+	TransferStatus   StatusType       `json:"transfer_status" `
+	Views            int32            `json:"views" `
+	Likes            int32            `json:"likes" `
+	Hidden           bool             `json:"hidden" `
+	PublishedOn      time.Time        `json:"published_on"` // Необязательное поле
+	UpdatedAt        time.Time        `json:"updated_at"`   // Необязательное поле
+	Tags             pq.StringArray   `json:"tags" gorm:"type:text[]" swaggertype:"array,string" `
+	Genres           pq.StringArray   `json:"genres" gorm:"type:text[]" swaggertype:"array,string" `
+	Bookmark         int              `json:"bookmark"`
+	Version          uint             `json:"version" gorm:"not null;default:1"`                      // Увеличивается при каждом изменении, отдаётся как ETag
+	DeletedAt        gorm.DeletedAt   `json:"deleted_at,omitempty" gorm:"index" swaggertype:"string"` // Время перемещения в корзину
+	Broken           bool             `json:"broken" gorm:"not null;default:false"`                   // Файл обложки или баннера не найден в хранилище, см. check-storage
+	Duplicates       []Duplicate      `json:"duplicates,omitempty" gorm:"-"`                          // Похожие комиксы, найденные при загрузке обложки
+}
+
+// ErrVersionMismatch - комикс был изменён после того, как клиент получил его версию
+var ErrVersionMismatch = errors.New("comic has been modified by someone else")
+
+// AfterFind заполняет публичные адреса изображений по ключам хранилища
+func (comic *Comics) AfterFind(tx *gorm.DB) error {
+	comic.fillURLs()
+	return nil
+}
+
+func (comic *Comics) AfterSave(tx *gorm.DB) error {
+	comic.fillURLs()
+	return nil
+}
+
+func (comic *Comics) fillURLs() {
+	private := comic.Hidden || comic.DeletedAt.Valid
+	comic.ImageURL = imageURL(comic.ImagePath, private)
+	comic.BannerURL = imageURL(comic.BannerPath, private)
+	fillVariantURLs(comic.ImagePath, comic.ImageVariants, private)
+	fillVariantURLs(comic.BannerPath, comic.BannerVariants, private)
+}
+
+func fillVariantURLs(source string, variants imaging.Variants, private bool) {
+	for i, variant := range variants {
+		variants[i].URL = imageURL(imaging.VariantKey(source, variant.Name, variant.Format), private)
+	}
+}
+
+// ETag возвращает сильный ETag текущей версии комикса
+func (comic *Comics) ETag() string {
+	return fmt.Sprintf(`"%d"`, comic.Version)
 }
 
 func GetComicsInfo(name string) (*Comics, error) {
@@ -88,10 +136,48 @@ func GetComicsInfo(name string) (*Comics, error) {
 	return &comics, nil
 }
 
-func UploadComics(dto *Comics, imageStream, bannerStream io.Reader) (*Comics, error) {
+func UploadComics(dto *Comics, imageStream, bannerStream io.Reader, userID uint) (*Comics, error) {
+	// Изображения проверяются до любых записей, ошибки обоих полей возвращаются вместе
+	var validation ValidationError
+	cover, err := readComicImage(imageStream, "image_path", imaging.CoverLimits, &validation)
+	if err != nil {
+		return nil, err
+	}
+	banner, err := readComicImage(bannerStream, "banner_path", imaging.BannerLimits, &validation)
+	if err != nil {
+		return nil, err
+	}
+	// alternative_name становится slug в адресах и префиксом ключей хранилища, поэтому всегда
+	// приводится к виду slug.Make. Пустое или кириллическое имя заменяется транслитерацией Name.
+	if strings.ContainsAny(dto.AlternativeName, `/\`) || strings.Contains(dto.AlternativeName, "..") {
+		validation.add("alternative_name", "must not contain slashes or ..")
+	} else {
+		source := dto.AlternativeName
+		if source == "" || containsCyrillic(source) {
+			source = dto.Name
+		}
+		dto.AlternativeName = slug.Make(source)
+		if dto.AlternativeName == "" {
+			validation.add("alternative_name", "must contain letters or digits")
+		}
+	}
+	if len(validation.Fields) > 0 {
+		return nil, &validation
+	}
+
+	coverHash := imaging.DHash(cover)
+	dto.Duplicates, err = checkDuplicates("comic", func(threshold int) ([]Duplicate, error) {
+		return findCoverDuplicates(models.Database, coverHash, 0, threshold)
+	})
+	if err != nil {
+		return nil, err
+	}
+	dto.ImageHash = hashValue(coverHash)
+
 	var existingComic Comics
 
-	if err := models.Database.Where("alternative_name = ?", dto.AlternativeName).First(&existingComic).Error; err == nil {
+	// Комиксы в корзине тоже занимают slug, иначе их нельзя будет восстановить
+	if err := models.Database.Unscoped().Where("alternative_name = ?", dto.AlternativeName).First(&existingComic).Error; err == nil {
 		// Если запись существует, возвращаем ошибку
 		return nil, errors.New("a comic with the same alternative name already exists")
 	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
@@ -99,15 +185,6 @@ func UploadComics(dto *Comics, imageStream, bannerStream io.Reader) (*Comics, er
 		return nil, fmt.Errorf("failed to check existing comic: %w", err)
 	}
 
-	// Логирование для отладки
-	log.Printf("Checking for existing comic with name: %s", dto.Name)
-
-	// Создание AlternativeName на английском, если он пуст или содержит кириллицу
-	if dto.AlternativeName == "" || containsCyrillic(dto.AlternativeName) {
-		translatedName := slug.Make(dto.Name)
-		dto.AlternativeName = translatedName
-	}
-
 	// Установка текущих даты и времени для PublishedOn и UpdatedAt, если они не заданы
 	now := time.Now()
 	if dto.PublishedOn.IsZero() {
@@ -117,52 +194,130 @@ func UploadComics(dto *Comics, imageStream, bannerStream io.Reader) (*Comics, er
 		dto.UpdatedAt = now
 	}
 
-	// Создание директории для изображений, если она еще не существует
-	imageDir := fmt.Sprintf("./main/images/%s", dto.AlternativeName)
-	if err := os.MkdirAll(filepath.Join(imageDir, "banners"), os.ModePerm); err != nil {
-		return nil, fmt.Errorf("failed to create banners directory: %w", err)
-	}
-	if err := os.MkdirAll(filepath.Join(imageDir, "cover"), os.ModePerm); err != nil {
-		return nil, fmt.Errorf("failed to create cover directory: %w", err)
-	}
-	if err := os.MkdirAll(filepath.Join(imageDir, "chapters"), os.ModePerm); err != nil {
-		return nil, fmt.Errorf("failed to create chapters directory: %w", err)
-	}
+	dto.Version = 1
 
-	var err error
-
-	dto.ImagePath, err = saveImage(imageStream, imageDir, "cover.jpg")
+	dto.ImagePath, dto.ImageVariants, err = saveComicImage(cover, dto.AlternativeName, "cover", imaging.CoverSizes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to save cover image: %w", err)
 	}
 
-	dto.BannerPath, err = saveImage(bannerStream, imageDir, "banner.jpg")
+	dto.BannerPath, dto.BannerVariants, err = saveComicImage(banner, dto.AlternativeName, "banner", imaging.BannerSizes)
 	if err != nil {
+		deleteImages(comicImageKeys(dto.ImagePath, dto.ImageVariants)...)
 		return nil, fmt.Errorf("failed to save banner image: %w", err)
 	}
 
-	// Сохранение в базу данных
-	err = models.Database.Create(dto).Error
+	// Сохранение в базу данных вместе с первой ревизией
+	err = models.Database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(dto).Error; err != nil {
+			return err
+		}
+		return recordRevision(tx, nil, dto, userID, nil)
+	})
 	if err != nil {
+		deleteImages(append(comicImageKeys(dto.ImagePath, dto.ImageVariants), comicImageKeys(dto.BannerPath, dto.BannerVariants)...)...)
 		return nil, err
 	}
 	return dto, nil
 }
 
-// saveImage сохраняет изображение из потока в файл и возвращает путь
-func saveImage(imageStream io.Reader, dir, filename string) (string, error) {
-	path := filepath.Join(dir, filename)
-	file, err := os.Create(path)
-	if err != nil {
+// saveImage сохраняет изображение из потока в хранилище и возвращает ключ
+func saveImage(imageStream io.Reader, key string) (string, error) {
+	if err := storage.Default.Put(key, imageStream, -1, storage.ContentType(key)); err != nil {
 		return "", err
 	}
-	defer file.Close()
+	return key, nil
+}
+
+// readComicImage читает и проверяет загруженное изображение. Если файл не прошёл проверку,
+// ошибка добавляется в validation под именем поля field, а изображение не возвращается.
+func readComicImage(imageStream io.Reader, field string, limits imaging.Limits, validation *ValidationError) (image.Image, error) {
+	if imageStream == nil {
+		return nil, nil
+	}
 
-	_, err = io.Copy(file, imageStream)
+	// Читаем на байт больше лимита, чтобы Inspect увидел превышение размера
+	data, err := io.ReadAll(io.LimitReader(imageStream, int64(limits.MaxBytes)+1))
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("failed to read %s: %w", field, err)
+	}
+
+	_, img, err := imaging.Inspect(data, limits)
+	if imaging.IsInvalidImage(err) {
+		validation.add(field, err.Error())
+		return nil, nil
+	}
+	return img, err
+}
+
+// saveComicImage сохраняет обложку или баннер без метаданных под новым ключом
+// вида "<slug>/cover-<random>.jpg" вместе с вариантами для srcset.
+// Ключ меняется при каждой загрузке, поэтому отданное изображение можно кэшировать навсегда.
+func saveComicImage(img image.Image, slug, name string, sizes []imaging.Size) (string, imaging.Variants, error) {
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return "", nil, err
+	}
+
+	format := imaging.SourceFormat(img)
+	var original bytes.Buffer
+	if err := imaging.Encode(&original, img, format); err != nil {
+		return "", nil, err
+	}
+	key, err := saveImage(&original, storage.Key(slug, fmt.Sprintf("%s-%x%s", name, token, imaging.Extension(format))))
+	if err != nil {
+		return "", nil, err
+	}
+
+	variants := make(imaging.Variants, 0, len(sizes)*len(imaging.VariantFormats))
+	for _, size := range sizes {
+		for _, variantFormat := range imaging.VariantFormats {
+			encoded, variant, err := imaging.Render(img, size.Width, variantFormat)
+			if err == nil {
+				variant.Name = size.Name
+				_, err = saveImage(bytes.NewReader(encoded), imaging.VariantKey(key, size.Name, variantFormat))
+			}
+			if err != nil {
+				deleteImages(comicImageKeys(key, variants)...)
+				return "", nil, fmt.Errorf("failed to create %s variant: %w", size.Name, err)
+			}
+			variants = append(variants, variant)
+		}
+	}
+	return key, variants, nil
+}
+
+// comicImageKeys возвращает ключи изображения и всех его вариантов
+func comicImageKeys(key string, variants imaging.Variants) []string {
+	if key == "" {
+		return nil
+	}
+	keys := []string{key}
+	for _, variant := range variants {
+		keys = append(keys, imaging.VariantKey(key, variant.Name, variant.Format))
+	}
+	return keys
+}
+
+// deleteImages удаляет изображения, которые больше ни на что не ссылаются,
+// вместе с вариантами, созданными при раздаче ("<key>-w320.webp")
+func deleteImages(keys ...string) {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := storage.Default.Delete(key); err != nil {
+			log.Printf("Failed to delete image %s: %v", key, err)
+		}
+
+		derivedPrefix := strings.TrimSuffix(key, path.Ext(key)) + "-"
+		err := storage.Default.Walk(derivedPrefix, func(info storage.ObjectInfo) error {
+			return storage.Default.Delete(info.Key)
+		})
+		if err != nil {
+			log.Printf("Failed to delete variants of %s: %v", key, err)
+		}
 	}
-	return path, nil
 }
 
 // Проверка, содержит ли строка кириллические символы
@@ -175,67 +330,316 @@ func containsCyrillic(text string) bool {
 	return false
 }
 
-func DeleteComicByName(name string) (*Comics, error) {
+// DeleteComicBySlug перемещает комикс в корзину. Главы и изображения остаются
+// до окончательной очистки корзины, см. PurgeTrash.
+// version должна совпадать с текущей версией комикса, иначе возвращается ErrVersionMismatch.
+func DeleteComicBySlug(slug string, version uint) (*Comics, error) {
 	var comic Comics
 
 	// Поиск комикса по альтернативному имени
-	err := models.Database.Where("alternative_name = ?", name).First(&comic).Error
+	err := models.Database.Where("alternative_name = ?", slug).First(&comic).Error
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("comic not found")
-		}
 		return nil, err
 	}
-
-	// Удаление найденного комикса
-	if err := models.Database.Delete(&comic).Error; err != nil {
-		return nil, fmt.Errorf("failed to delete comic: %w", err)
+	if comic.Version != version {
+		return nil, ErrVersionMismatch
 	}
 
-	// Удаление папки с изображениями
-	imageDir := fmt.Sprintf("./main/images/%s", comic.AlternativeName)
-	if err := os.RemoveAll(imageDir); err != nil {
-		return nil, fmt.Errorf("failed to delete image directory: %w", err)
+	result := models.Database.Model(&comic).Where("version = ?", version).Updates(map[string]interface{}{
+		"deleted_at": time.Now(),
+		"version":    gorm.Expr("version + 1"),
+	})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to delete comic: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrVersionMismatch
 	}
 
 	// Возврат удалённого комикса
+	if err := models.Database.Unscoped().First(&comic, comic.ID).Error; err != nil {
+		return nil, err
+	}
 	return &comic, nil
 }
 
-func UpdateComicsInfo(name string, updatedFields map[string]interface{}, newCover, newBanner io.Reader) (*Comics, error) {
+// ComicsUpdate - поля комикса, которые разрешено менять. nil означает, что поле не меняется.
+// Slug (alternative_name), пути к изображениям и счётчики просмотров, лайков и закладок не редактируются.
+type ComicsUpdate struct {
+	Name           *string     `json:"name"`
+	Description    *string     `json:"description"`
+	Rating         *float32    `json:"rating"`
+	Type           *ComicsType `json:"type_comics"`
+	Author         *string     `json:"author"`
+	Artist         *string     `json:"original_author"`
+	Year           *int        `json:"year"`
+	IsFinished     *bool       `json:"is_finished"`
+	Pegi           *PegiType   `json:"pegi"`
+	Status         *StatusType `json:"status"`
+	TransferStatus *StatusType `json:"transfer_status"`
+	Hidden         *bool       `json:"hidden"`
+	PublishedOn    *time.Time  `json:"published_on"`
+	Tags           *[]string   `json:"tags"`
+	Genres         *[]string   `json:"genres"`
+}
+
+// FieldError - ошибка проверки конкретного поля
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		messages = append(messages, field.Field+": "+field.Message)
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) add(field, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+}
+
+func (t ComicsType) Valid() bool {
+	switch t {
+	case Manga, Manhva, Comic, LifeComic, WebComic, Manuscript:
+		return true
+	}
+	return false
+}
+
+func (p PegiType) Valid() bool {
+	switch p {
+	case Pegi3, Pegi6, Pegi12, Pegi16, Pegi18:
+		return true
+	}
+	return false
+}
+
+func (s StatusType) Valid() bool {
+	switch s {
+	case Started, isFinished, Paused, Abandoned, Аnnounced:
+		return true
+	}
+	return false
+}
+
+// Validate проверяет переданные поля. Возвращает *ValidationError со списком ошибок.
+func (update *ComicsUpdate) Validate() error {
+	var validation ValidationError
+
+	if update.Name != nil && strings.TrimSpace(*update.Name) == "" {
+		validation.add("name", "must not be empty")
+	}
+	if update.Rating != nil && (*update.Rating < 0 || *update.Rating > 10) {
+		validation.add("rating", "must be between 0 and 10")
+	}
+	if update.Type != nil && !update.Type.Valid() {
+		validation.add("type_comics", "unknown comics type")
+	}
+	if update.Year != nil && (*update.Year < 1800 || *update.Year > time.Now().Year()+5) {
+		validation.add("year", "is out of range")
+	}
+	if update.Pegi != nil && !update.Pegi.Valid() {
+		validation.add("pegi", "unknown age rating")
+	}
+	if update.Status != nil && !update.Status.Valid() {
+		validation.add("status", "unknown status")
+	}
+	if update.TransferStatus != nil && !update.TransferStatus.Valid() {
+		validation.add("transfer_status", "unknown status")
+	}
+
+	if len(validation.Fields) > 0 {
+		return &validation
+	}
+	return nil
+}
+
+// columns возвращает изменяемые колонки для gorm Updates
+func (update *ComicsUpdate) columns() map[string]interface{} {
+	columns := map[string]interface{}{}
+	if update.Name != nil {
+		columns["name"] = strings.TrimSpace(*update.Name)
+	}
+	if update.Description != nil {
+		columns["description"] = *update.Description
+	}
+	if update.Rating != nil {
+		columns["rating"] = *update.Rating
+	}
+	if update.Type != nil {
+		columns["type"] = *update.Type
+	}
+	if update.Author != nil {
+		columns["author"] = *update.Author
+	}
+	if update.Artist != nil {
+		columns["artist"] = *update.Artist
+	}
+	if update.Year != nil {
+		columns["year"] = *update.Year
+	}
+	if update.IsFinished != nil {
+		columns["is_finished"] = *update.IsFinished
+	}
+	if update.Pegi != nil {
+		columns["pegi"] = *update.Pegi
+	}
+	if update.Status != nil {
+		columns["status"] = *update.Status
+	}
+	if update.TransferStatus != nil {
+		columns["transfer_status"] = *update.TransferStatus
+	}
+	if update.Hidden != nil {
+		columns["hidden"] = *update.Hidden
+	}
+	if update.PublishedOn != nil {
+		columns["published_on"] = *update.PublishedOn
+	}
+	if update.Tags != nil {
+		columns["tags"] = pq.StringArray(*update.Tags)
+	}
+	if update.Genres != nil {
+		columns["genres"] = pq.StringArray(*update.Genres)
+	}
+	return columns
+}
+
+// UpdateComicsInfo частично обновляет комикс по slug и при необходимости заменяет обложку и баннер.
+// version должна совпадать с текущей версией комикса, иначе возвращается ErrVersionMismatch.
+// Изменения метаданных записываются в ревизию от имени userID.
+func UpdateComicsInfo(slug string, version uint, update *ComicsUpdate, newCover, newBanner io.Reader, userID uint) (*Comics, error) {
+	var validation ValidationError
+	var fieldErrors *ValidationError
+	if err := update.Validate(); errors.As(err, &fieldErrors) {
+		validation.Fields = append(validation.Fields, fieldErrors.Fields...)
+	}
+	cover, err := readComicImage(newCover, "image_path", imaging.CoverLimits, &validation)
+	if err != nil {
+		return nil, err
+	}
+	banner, err := readComicImage(newBanner, "banner_path", imaging.BannerLimits, &validation)
+	if err != nil {
+		return nil, err
+	}
+	if len(validation.Fields) > 0 {
+		return nil, &validation
+	}
+
 	var comics Comics
-	err := models.Database.Where("alternative_name = ?", name).First(&comics).Error
+	err = models.Database.Where("alternative_name = ?", slug).First(&comics).Error
 	if err != nil {
 		return nil, err
 	}
+	if comics.Version != version {
+		return nil, ErrVersionMismatch
+	}
 
-	// Update cover image if newCover is provided
-	if newCover != nil {
-		imageDir := fmt.Sprintf("./main/images/%s", comics.AlternativeName)
-		comics.ImagePath, err = saveImage(newCover, imageDir, "cover.jpg")
+	var coverHash uint64
+	var duplicates []Duplicate
+	if cover != nil {
+		coverHash = imaging.DHash(cover)
+		duplicates, err = checkDuplicates("comic", func(threshold int) ([]Duplicate, error) {
+			return findCoverDuplicates(models.Database, coverHash, comics.ID, threshold)
+		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to save new cover image: %w", err)
+			return nil, err
 		}
-		updatedFields["image_path"] = comics.ImagePath
 	}
 
-	// Update banner image if newBanner is provided
-	if newBanner != nil {
-		imageDir := fmt.Sprintf("./main/images/%s", comics.AlternativeName)
-		comics.BannerPath, err = saveImage(newBanner, imageDir, "banner.jpg")
+	// Изображения и их варианты кодируются и сохраняются до транзакции, чтобы не держать её открытой.
+	// Если транзакция не удастся, сохранённые файлы удаляются.
+	before := comics
+	imageFields := map[string]interface{}{}
+	var replaced, saved []string
+	if cover != nil {
+		comics.ImagePath, comics.ImageVariants, err = saveComicImage(cover, comics.AlternativeName, "cover", imaging.CoverSizes)
 		if err != nil {
+			return nil, fmt.Errorf("failed to save new cover image: %w", err)
+		}
+		imageFields["image_path"] = comics.ImagePath
+		imageFields["image_variants"] = comics.ImageVariants
+		imageFields["image_hash"] = hashValue(coverHash)
+		replaced = append(replaced, comicImageKeys(before.ImagePath, before.ImageVariants)...)
+		saved = append(saved, comicImageKeys(comics.ImagePath, comics.ImageVariants)...)
+	}
+	if banner != nil {
+		comics.BannerPath, comics.BannerVariants, err = saveComicImage(banner, comics.AlternativeName, "banner", imaging.BannerSizes)
+		if err != nil {
+			deleteImages(saved...)
 			return nil, fmt.Errorf("failed to save new banner image: %w", err)
 		}
-		updatedFields["banner_path"] = comics.BannerPath
+		imageFields["banner_path"] = comics.BannerPath
+		imageFields["banner_variants"] = comics.BannerVariants
+		replaced = append(replaced, comicImageKeys(before.BannerPath, before.BannerVariants)...)
+		saved = append(saved, comicImageKeys(comics.BannerPath, comics.BannerVariants)...)
 	}
 
-	err = models.Database.Model(&comics).Updates(updatedFields).Error
+	err = models.Database.Transaction(func(tx *gorm.DB) error {
+		updatedFields := update.columns()
+		for column, value := range imageFields {
+			updatedFields[column] = value
+		}
+		updatedFields["version"] = gorm.Expr("version + 1")
+
+		// Условие по версии защищает от одновременного редактирования
+		result := tx.Model(&comics).Where("version = ?", version).Updates(updatedFields)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrVersionMismatch
+		}
+
+		// Перечитываем комикс, чтобы получить актуальную версию
+		if err := tx.First(&comics, comics.ID).Error; err != nil {
+			return err
+		}
+		return recordRevision(tx, &before, &comics, userID, nil)
+	})
 	if err != nil {
+		deleteImages(saved...)
 		return nil, err
 	}
+
+	// Старые изображения удаляем только после фиксации транзакции
+	deleteImages(replaced...)
+	comics.Duplicates = duplicates
 	return &comics, nil
 }
 
 func AutoMigrateComics() {
-	models.Database.AutoMigrate(&Comics{})
+	models.Database.AutoMigrate(&Comics{}, &Chapter{}, &Page{}, &ComicRevision{}, &Upload{})
+
+	// GIN индексы для фильтрации каталога по жанрам и тегам
+	models.Database.Exec("CREATE INDEX IF NOT EXISTS idx_comics_genres ON comics USING GIN (genres)")
+	models.Database.Exec("CREATE INDEX IF NOT EXISTS idx_comics_tags ON comics USING GIN (tags)")
+
+	migrateSearch()
+	migrateHashBands()
+	migrateStorageKeys()
+}
+
+// migrateStorageKeys переводит старые пути вида "main/images/<slug>/cover.jpg"
+// в ключи хранилища "<slug>/cover.jpg". Файлы при этом не перемещаются:
+// корень локального хранилища по умолчанию - та же директория ./main/images.
+func migrateStorageKeys() {
+	const legacyPrefix = `^(\./)?main/images/`
+	for _, column := range []struct{ table, name string }{
+		{"comics", "image_path"},
+		{"comics", "banner_path"},
+		{"pages", "file_path"},
+	} {
+		models.Database.Exec(
+			fmt.Sprintf("UPDATE %[1]s SET %[2]s = regexp_replace(%[2]s, ?, '') WHERE %[2]s ~ ?", column.table, column.name),
+			legacyPrefix, legacyPrefix,
+		)
+	}
 }
@@ -0,0 +1,453 @@
+package structur
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"main/src/imaging"
+	"main/src/models"
+	"main/src/storage"
+	"main/src/utils"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+type DuplicatePolicy string
+
+const (
+	DuplicatesOff    DuplicatePolicy = "off"    // Хэши сохраняются, но не проверяются
+	DuplicatesWarn   DuplicatePolicy = "warn"   // Загрузка проходит, совпадения возвращаются в ответе
+	DuplicatesReject DuplicatePolicy = "reject" // Загрузка отклоняется
+)
+
+const (
+	DefaultDuplicateThreshold = 5
+	// Доля страниц новой главы, совпавших со страницами другой главы,
+	// начиная с которой глава считается повторной загрузкой
+	duplicatePageShare = 0.5
+	duplicateLimit     = 10
+)
+
+// GetDuplicatePolicy читает политику из переменной окружения DUPLICATE_POLICY (off, warn, reject)
+func GetDuplicatePolicy() DuplicatePolicy {
+	policy := DuplicatePolicy(strings.ToLower(utils.GetEnv("DUPLICATE_POLICY", string(DuplicatesWarn))))
+	switch policy {
+	case DuplicatesOff, DuplicatesWarn, DuplicatesReject:
+		return policy
+	}
+	log.Printf("Unknown DUPLICATE_POLICY=%q, using %s", policy, DuplicatesWarn)
+	return DuplicatesWarn
+}
+
+// DuplicateThreshold - максимальное расстояние Хэмминга между хэшами похожих изображений,
+// переменная окружения DUPLICATE_THRESHOLD (0-64)
+func DuplicateThreshold() int {
+	threshold, err := strconv.Atoi(utils.GetEnv("DUPLICATE_THRESHOLD", ""))
+	if err != nil || threshold < 0 || threshold > 64 {
+		return DefaultDuplicateThreshold
+	}
+	return threshold
+}
+
+// Duplicate - уже загруженный комикс или глава, похожие на новую загрузку
+type Duplicate struct {
+	ComicsID      uint    `json:"comics_id"`
+	Slug          string  `json:"slug"`
+	Name          string  `json:"name"`
+	ChapterID     uint    `json:"chapter_id,omitempty"`
+	ChapterNumber float64 `json:"chapter_number,omitempty"`
+	Distance      int     `json:"distance"`                // Расстояние между обложками или наибольшее между совпавшими страницами
+	MatchedPages  int     `json:"matched_pages,omitempty"` // Сколько страниц новой главы нашлось в этой главе
+}
+
+// DuplicateError - загрузка отклонена политикой DuplicatesReject
+type DuplicateError struct {
+	Subject    string // "comic" или "chapter"
+	Duplicates []Duplicate
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("%s looks like a duplicate of %d existing upload(s)", e.Subject, len(e.Duplicates))
+}
+
+// hashValue переводит хэш в значение колонки bigint. Знак не важен:
+// сравниваются только биты. Хэши однотонных изображений не сохраняются.
+func hashValue(hash uint64) *int64 {
+	if !imaging.Informative(hash) {
+		return nil
+	}
+	value := int64(hash)
+	return &value
+}
+
+// hammingSQL - выражение Postgres для числа различающихся бит двух bigint
+func hammingSQL(a, b string) string {
+	return fmt.Sprintf("length(replace(((%s # %s)::bit(64))::text, '0', ''))", a, b)
+}
+
+// checkDuplicates применяет политику к найденным совпадениям: при DuplicatesReject
+// возвращает *DuplicateError, иначе сами совпадения для предупреждения в ответе
+func checkDuplicates(subject string, find func(threshold int) ([]Duplicate, error)) ([]Duplicate, error) {
+	policy := GetDuplicatePolicy()
+	if policy == DuplicatesOff {
+		return nil, nil
+	}
+
+	duplicates, err := find(DuplicateThreshold())
+	if err != nil {
+		return nil, fmt.Errorf("failed to check duplicates: %w", err)
+	}
+	if len(duplicates) > 0 && policy == DuplicatesReject {
+		return nil, &DuplicateError{Subject: subject, Duplicates: duplicates}
+	}
+	return duplicates, nil
+}
+
+// findCoverDuplicates ищет комиксы с похожей обложкой, кроме комикса excludeID.
+// Комиксы в корзине не учитываются.
+func findCoverDuplicates(tx *gorm.DB, hash uint64, excludeID uint, threshold int) ([]Duplicate, error) {
+	duplicates := []Duplicate{}
+	if !imaging.Informative(hash) {
+		return duplicates, nil
+	}
+
+	distance := hammingSQL("image_hash", "?")
+	err := tx.Model(&Comics{}).
+		Select("id AS comics_id, alternative_name AS slug, name, "+distance+" AS distance", int64(hash)).
+		Where("image_hash IS NOT NULL AND id <> ?", excludeID).
+		Where(distance+" <= ?", int64(hash), threshold).
+		Order("distance, id").
+		Limit(duplicateLimit).
+		Scan(&duplicates).Error
+	return duplicates, err
+}
+
+// Хэши страниц делятся на hashBands участков по hashBandBits бит, участки хранятся в генерируемых
+// колонках pages.hash_band0..3 с индексами. Если хэши отличаются не больше чем на threshold бит,
+// хотя бы один участок отличается не больше чем на threshold/hashBands бит, поэтому кандидаты
+// выбираются по индексу среди близких значений участков, а не перебором всех страниц.
+const (
+	hashBands    = 4
+	hashBandBits = 16
+	// При большем расстоянии внутри участка близких значений слишком много для выборки
+	// по индексу, и страницы сравниваются перебором
+	maxBandRadius = 2
+)
+
+// migrateHashBands создаёт колонки участков хэша страниц и индексы по ним.
+// Колонки генерируемые, поэтому заполняются и для страниц, загруженных раньше.
+func migrateHashBands() {
+	for band := 0; band < hashBands; band++ {
+		shift := (hashBands - 1 - band) * hashBandBits
+		models.Database.Exec(fmt.Sprintf(
+			"ALTER TABLE pages ADD COLUMN IF NOT EXISTS hash_band%d integer GENERATED ALWAYS AS (((hash >> %d) & %d)::integer) STORED",
+			band, shift, 1<<hashBandBits-1,
+		))
+		models.Database.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_pages_hash_band%[1]d ON pages (hash_band%[1]d)", band))
+	}
+}
+
+// bandValues возвращает значения участка band хэшей hashes вместе со всеми значениями,
+// отличающимися от них не больше чем на radius бит
+func bandValues(hashes []int64, band, radius int) pq.Int64Array {
+	shift := (hashBands - 1 - band) * hashBandBits
+	seen := map[uint64]bool{}
+	values := pq.Int64Array{}
+
+	var visit func(value uint64, from, left int)
+	visit = func(value uint64, from, left int) {
+		if !seen[value] {
+			seen[value] = true
+			values = append(values, int64(value))
+		}
+		if left == 0 {
+			return
+		}
+		for bit := from; bit < hashBandBits; bit++ {
+			visit(value^1<<bit, bit+1, left-1)
+		}
+	}
+	for _, hash := range hashes {
+		visit(uint64(hash)>>shift&(1<<hashBandBits-1), 0, radius)
+	}
+	return values
+}
+
+// findChapterDuplicates ищет главы, в которых нашлась заметная доля страниц с хэшами hashes.
+// Страницы самой главы excludeChapterID и однотонные страницы не учитываются.
+func findChapterDuplicates(tx *gorm.DB, hashes []uint64, excludeChapterID uint, threshold int) ([]Duplicate, error) {
+	duplicates := []Duplicate{}
+	values := make(pq.Int64Array, 0, len(hashes))
+	for _, hash := range hashes {
+		if imaging.Informative(hash) {
+			values = append(values, int64(hash))
+		}
+	}
+	if len(values) == 0 {
+		return duplicates, nil
+	}
+
+	minMatches := int(float64(len(values))*duplicatePageShare + 0.5)
+	if minMatches < 1 {
+		minMatches = 1
+	}
+
+	candidates := tx.Table("pages").
+		Select("id, chapter_id, hash").
+		Where("hash IS NOT NULL AND chapter_id <> ?", excludeChapterID)
+	if radius := threshold / hashBands; radius <= maxBandRadius {
+		bands := tx.Where("hash_band0 = ANY(?)", bandValues(values, 0, radius))
+		for band := 1; band < hashBands; band++ {
+			bands = bands.Or(fmt.Sprintf("hash_band%d = ANY(?)", band), bandValues(values, band, radius))
+		}
+		candidates = candidates.Where(bands)
+	}
+
+	distance := hammingSQL("p.hash", "h.hash")
+	err := tx.Raw(`
+		SELECT m.id AS comics_id, m.alternative_name AS slug, m.name,
+			c.id AS chapter_id, c.number AS chapter_number,
+			MAX(`+distance+`) AS distance,
+			COUNT(DISTINCT h.ord) AS matched_pages
+		FROM (?) p
+		JOIN unnest(?::bigint[]) WITH ORDINALITY AS h(hash, ord) ON `+distance+` <= ?
+		JOIN chapters c ON c.id = p.chapter_id
+		JOIN comics m ON m.id = c.comics_id AND m.deleted_at IS NULL
+		GROUP BY m.id, m.alternative_name, m.name, c.id, c.number
+		HAVING COUNT(DISTINCT h.ord) >= ?
+		ORDER BY matched_pages DESC, c.id
+		LIMIT ?`,
+		candidates, values, threshold, minMatches, duplicateLimit,
+	).Scan(&duplicates).Error
+	return duplicates, err
+}
+
+// DuplicatePair - два комикса с похожими обложками
+type DuplicatePair struct {
+	First    Comics `json:"first"`
+	Second   Comics `json:"second"`
+	Distance int    `json:"distance"`
+}
+
+// MaxDuplicatePairsThreshold - наибольший порог для списка пар. Пары ищутся по совпадающим
+// участкам хэшей, и при большом пороге участки становятся слишком короткими, чтобы отсеивать кандидатов.
+const MaxDuplicatePairsThreshold = 16
+
+// comicHash - хэш обложки комикса
+type comicHash struct {
+	ID   uint
+	Hash int64
+}
+
+// duplicateRow - пара комиксов с расстоянием между хэшами обложек
+type duplicateRow struct {
+	FirstID  uint
+	SecondID uint
+	Distance int
+}
+
+// similarPairs находит пары хэшей на расстоянии не больше threshold. Если 64 бита хэша разделить
+// на threshold+1 участков, у похожих хэшей хотя бы один участок совпадает целиком, поэтому
+// сравниваются только хэши из одной корзины по значению участка, а не все со всеми.
+func similarPairs(hashes []comicHash, threshold int) []duplicateRow {
+	bands := threshold + 1
+	if bands > 64 {
+		bands = 64
+	}
+
+	seen := map[[2]int]bool{}
+	var rows []duplicateRow
+	for band := 0; band < bands; band++ {
+		// Участки почти одинаковой ширины, вместе покрывающие все 64 бита
+		low, high := band*64/bands, (band+1)*64/bands
+		mask := uint64(1)<<(high-low) - 1
+
+		buckets := map[uint64][]int{}
+		for i, hash := range hashes {
+			key := uint64(hash.Hash) >> low & mask
+			buckets[key] = append(buckets[key], i)
+		}
+		for _, bucket := range buckets {
+			for x := 0; x < len(bucket); x++ {
+				for y := x + 1; y < len(bucket); y++ {
+					i, j := bucket[x], bucket[y]
+					if seen[[2]int{i, j}] {
+						continue
+					}
+					seen[[2]int{i, j}] = true
+
+					distance := bits.OnesCount64(uint64(hashes[i].Hash ^ hashes[j].Hash))
+					if distance > threshold {
+						continue
+					}
+					first, second := hashes[i].ID, hashes[j].ID
+					if first > second {
+						first, second = second, first
+					}
+					rows = append(rows, duplicateRow{FirstID: first, SecondID: second, Distance: distance})
+				}
+			}
+		}
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Distance != rows[j].Distance {
+			return rows[i].Distance < rows[j].Distance
+		}
+		if rows[i].FirstID != rows[j].FirstID {
+			return rows[i].FirstID < rows[j].FirstID
+		}
+		return rows[i].SecondID < rows[j].SecondID
+	})
+	return rows
+}
+
+// GetDuplicateComics возвращает пары комиксов с похожими обложками, начиная с самых похожих.
+// threshold не больше MaxDuplicatePairsThreshold.
+func GetDuplicateComics(threshold, limit, offset int) ([]DuplicatePair, error) {
+	if threshold > MaxDuplicatePairsThreshold {
+		threshold = MaxDuplicatePairsThreshold
+	}
+
+	var hashes []comicHash
+	err := models.Database.Model(&Comics{}).
+		Select("id, image_hash AS hash").
+		Where("image_hash IS NOT NULL").
+		Scan(&hashes).Error
+	if err != nil {
+		return nil, err
+	}
+
+	rows := similarPairs(hashes, threshold)
+	if offset >= len(rows) {
+		rows = nil
+	} else {
+		rows = rows[offset:]
+	}
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+
+	ids := make([]uint, 0, len(rows)*2)
+	for _, row := range rows {
+		ids = append(ids, row.FirstID, row.SecondID)
+	}
+	var comics []Comics
+	if len(ids) > 0 {
+		if err := models.Database.Where("id IN ?", ids).Find(&comics).Error; err != nil {
+			return nil, err
+		}
+	}
+	byID := make(map[uint]Comics, len(comics))
+	for _, comic := range comics {
+		byID[comic.ID] = comic
+	}
+
+	pairs := make([]DuplicatePair, 0, len(rows))
+	for _, row := range rows {
+		pairs = append(pairs, DuplicatePair{First: byID[row.FirstID], Second: byID[row.SecondID], Distance: row.Distance})
+	}
+	return pairs, nil
+}
+
+// HashBackfill - итог BackfillHashes
+type HashBackfill struct {
+	Covers int // Обложки, получившие хэш
+	Pages  int // Страницы, получившие хэш
+	// Однотонные изображения: хэш у них не сохраняется, но они отмечаются обработанными
+	// и при следующем запуске не читаются снова
+	Uninformative int
+	Failed        int // Не удалось прочитать, будут прочитаны при следующем запуске
+}
+
+// BackfillHashes вычисляет хэши обложек и страниц, загруженных до появления поиска дубликатов.
+// Изображения, которые не удалось прочитать, пропускаются с записью в лог.
+func BackfillHashes() (HashBackfill, error) {
+	var result HashBackfill
+	var comics []Comics
+	err := models.Database.Unscoped().
+		Where("image_hash IS NULL AND NOT image_hash_checked AND image_path <> ''").
+		Find(&comics).Error
+	if err != nil {
+		return result, err
+	}
+
+	for _, comic := range comics {
+		hash, err := storedImageHash(comic.ImagePath)
+		if err != nil {
+			log.Printf("Failed to hash cover of comic %d: %v", comic.ID, err)
+			result.Failed++
+			continue
+		}
+		err = models.Database.Unscoped().Model(&Comics{}).Where("id = ?", comic.ID).Updates(map[string]interface{}{
+			"image_hash":         hashValue(hash),
+			"image_hash_checked": true,
+		}).Error
+		if err != nil {
+			return result, err
+		}
+		if hashValue(hash) == nil {
+			result.Uninformative++
+		} else {
+			result.Covers++
+		}
+	}
+
+	var lastID uint
+	for {
+		var pages []Page
+		err := models.Database.Where("hash IS NULL AND NOT hash_checked AND id > ?", lastID).Order("id").Limit(100).Find(&pages).Error
+		if err != nil {
+			return result, err
+		}
+		if len(pages) == 0 {
+			return result, nil
+		}
+
+		for _, page := range pages {
+			lastID = page.ID
+			hash, err := storedImageHash(page.FilePath)
+			if err != nil {
+				log.Printf("Failed to hash page %d: %v", page.ID, err)
+				result.Failed++
+				continue
+			}
+			err = models.Database.Model(&Page{}).Where("id = ?", page.ID).Updates(map[string]interface{}{
+				"hash":         hashValue(hash),
+				"hash_checked": true,
+			}).Error
+			if err != nil {
+				return result, err
+			}
+			if hashValue(hash) == nil {
+				result.Uninformative++
+			} else {
+				result.Pages++
+			}
+		}
+	}
+}
+
+// storedImageHash читает изображение из хранилища и вычисляет его хэш
+func storedImageHash(key string) (uint64, error) {
+	object, err := storage.Default.Open(key)
+	if err != nil {
+		return 0, err
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(io.LimitReader(object, int64(imaging.PageLimits.MaxBytes)+1))
+	if err != nil {
+		return 0, err
+	}
+	img, err := imaging.Decode(data)
+	if err != nil {
+		return 0, err
+	}
+	return imaging.DHash(img), nil
+}
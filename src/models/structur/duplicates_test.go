@@ -0,0 +1,159 @@
+package structur
+
+import (
+	"math/bits"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// flipBits меняет в хэше count случайных различных бит
+func flipBits(random *rand.Rand, hash int64, count int) int64 {
+	for _, bit := range random.Perm(64)[:count] {
+		hash ^= 1 << bit
+	}
+	return hash
+}
+
+// bruteForcePairs сравнивает все хэши со всеми
+func bruteForcePairs(hashes []comicHash, threshold int) []duplicateRow {
+	var rows []duplicateRow
+	for i := range hashes {
+		for j := i + 1; j < len(hashes); j++ {
+			distance := bits.OnesCount64(uint64(hashes[i].Hash ^ hashes[j].Hash))
+			if distance <= threshold {
+				first, second := hashes[i].ID, hashes[j].ID
+				if first > second {
+					first, second = second, first
+				}
+				rows = append(rows, duplicateRow{FirstID: first, SecondID: second, Distance: distance})
+			}
+		}
+	}
+	return rows
+}
+
+func TestSimilarPairs(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	// Группы хэшей вокруг случайных центров на разных расстояниях, чтобы пары были у любого порога
+	var hashes []comicHash
+	for group := 0; group < 20; group++ {
+		center := int64(random.Uint64())
+		for distance := 0; distance <= 20; distance += 2 {
+			hashes = append(hashes, comicHash{ID: uint(len(hashes) + 1), Hash: flipBits(random, center, distance)})
+		}
+	}
+
+	// threshold=0 - один участок во все 64 бита, threshold=63 и 64 - участки по одному биту
+	for _, threshold := range []int{0, 1, 5, 16, 63, 64} {
+		want := bruteForcePairs(hashes, threshold)
+		got := similarPairs(hashes, threshold)
+		if len(got) != len(want) {
+			t.Fatalf("threshold %d: %d pairs, brute force finds %d", threshold, len(got), len(want))
+		}
+		found := map[duplicateRow]bool{}
+		for _, row := range got {
+			if found[row] {
+				t.Errorf("threshold %d: pair %+v reported twice", threshold, row)
+			}
+			found[row] = true
+		}
+		for _, row := range want {
+			if !found[row] {
+				t.Errorf("threshold %d: pair %+v not found", threshold, row)
+			}
+		}
+		for i := 1; i < len(got); i++ {
+			if got[i-1].Distance > got[i].Distance {
+				t.Fatalf("threshold %d: pairs are not ordered by distance", threshold)
+			}
+		}
+	}
+}
+
+func TestSimilarPairsExact(t *testing.T) {
+	hashes := []comicHash{
+		{ID: 3, Hash: -1 << 8},
+		{ID: 1, Hash: -1 << 8},
+		{ID: 2, Hash: -1<<8 | 1},
+	}
+	tests := []struct {
+		name      string
+		threshold int
+		want      []duplicateRow
+	}{
+		{name: "identical only", threshold: 0, want: []duplicateRow{{FirstID: 1, SecondID: 3, Distance: 0}}},
+		{name: "one bit apart", threshold: 1, want: []duplicateRow{
+			{FirstID: 1, SecondID: 3, Distance: 0},
+			{FirstID: 1, SecondID: 2, Distance: 1},
+			{FirstID: 2, SecondID: 3, Distance: 1},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := similarPairs(hashes, tt.threshold); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("similarPairs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBandValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		hashes []int64
+		band   int
+		radius int
+		want   int // Сколько различных значений участка
+	}{
+		{name: "exact", hashes: []int64{0x1234_5678_9ABC_DEF0}, band: 0, radius: 0, want: 1},
+		{name: "one bit", hashes: []int64{0x1234_5678_9ABC_DEF0}, band: 1, radius: 1, want: 1 + 16},
+		{name: "two bits", hashes: []int64{0x1234_5678_9ABC_DEF0}, band: 3, radius: 2, want: 1 + 16 + 120},
+		{name: "shared band", hashes: []int64{0x1234_0000_0000_0000, 0x1234_FFFF_FFFF_FFFF}, band: 0, radius: 0, want: 1},
+		{name: "negative hash", hashes: []int64{-1}, band: 0, radius: 0, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := bandValues(tt.hashes, tt.band, tt.radius)
+			if len(values) != tt.want {
+				t.Errorf("bandValues() returned %d values, want %d", len(values), tt.want)
+			}
+			for _, value := range values {
+				if value < 0 || value >= 1<<hashBandBits {
+					t.Errorf("value %d does not fit in %d bits", value, hashBandBits)
+				}
+			}
+		})
+	}
+
+	if got := bandValues([]int64{0x1234_5678_9ABC_DEF0}, 2, 0); got[0] != 0x9ABC {
+		t.Errorf("band 2 = %#x, want 0x9abc", got[0])
+	}
+}
+
+// Любой хэш на расстоянии не больше порога попадает в выборку хотя бы по одному участку
+func TestBandValuesFindSimilar(t *testing.T) {
+	random := rand.New(rand.NewSource(2))
+	for threshold := 0; threshold < (maxBandRadius+1)*hashBands; threshold++ {
+		radius := threshold / hashBands
+		for i := 0; i < 200; i++ {
+			hash := int64(random.Uint64())
+			similar := flipBits(random, hash, threshold)
+
+			matched := false
+			for band := 0; band < hashBands && !matched; band++ {
+				value := bandValues([]int64{similar}, band, 0)[0]
+				for _, candidate := range bandValues([]int64{hash}, band, radius) {
+					if candidate == value {
+						matched = true
+						break
+					}
+				}
+			}
+			if !matched {
+				t.Fatalf("threshold %d: hash %#x at distance %d from %#x is not selected by any band", threshold, uint64(similar), threshold, uint64(hash))
+			}
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package structur
+
+import (
+	"main/src/imaging"
+	"main/src/models"
+	"main/src/storage"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultOrphanMinAge - объекты моложе этого срока не считаются лишними:
+// изображения сохраняются в хранилище раньше, чем фиксируется запись в базе
+const DefaultOrphanMinAge = 24 * time.Hour
+
+// MissingImage - запись в базе, файл которой отсутствует в хранилище
+type MissingImage struct {
+	Kind      string `json:"kind"` // cover, banner, cover_variant, banner_variant или page
+	ComicsID  uint   `json:"comics_id"`
+	ChapterID uint   `json:"chapter_id,omitempty"`
+	PageID    uint   `json:"page_id,omitempty"`
+	Key       string `json:"key"`
+}
+
+// IntegrityReport - результат сверки хранилища с базой
+type IntegrityReport struct {
+	Objects     int                  `json:"objects"`      // Сколько объектов в хранилище
+	Orphans     []storage.ObjectInfo `json:"orphans"`      // Объекты, на которые нет ссылок
+	OrphanBytes int64                `json:"orphan_bytes"` // Суммарный размер лишних объектов
+	Missing     []MissingImage       `json:"missing"`
+}
+
+// CheckStorage сверяет хранилище с таблицами комиксов и страниц. Комиксы в корзине
+// учитываются: их изображения нужны для восстановления.
+// Объекты моложе minAge в список лишних не попадают.
+func CheckStorage(minAge time.Duration) (*IntegrityReport, error) {
+	references, err := storageReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	// Варианты, созданные при раздаче ("<base>-w320.webp"), принадлежат исходному изображению
+	bases := make(map[string]bool, len(references))
+	for key := range references {
+		bases[strings.TrimSuffix(key, path.Ext(key))] = true
+	}
+
+	report := &IntegrityReport{Orphans: []storage.ObjectInfo{}, Missing: []MissingImage{}}
+	present := make(map[string]bool, len(references))
+	cutoff := time.Now().Add(-minAge)
+	err = storage.Default.Walk("", func(info storage.ObjectInfo) error {
+		report.Objects++
+		if _, ok := references[info.Key]; ok {
+			present[info.Key] = true
+			return nil
+		}
+		if base, ok := imaging.DerivedBase(info.Key); ok && bases[base] {
+			return nil
+		}
+		if info.ModTime.Before(cutoff) {
+			report.Orphans = append(report.Orphans, info)
+			report.OrphanBytes += info.Size
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for key, reference := range references {
+		if !present[key] {
+			report.Missing = append(report.Missing, reference)
+		}
+	}
+	sort.Slice(report.Orphans, func(i, j int) bool { return report.Orphans[i].Key < report.Orphans[j].Key })
+	sort.Slice(report.Missing, func(i, j int) bool { return report.Missing[i].Key < report.Missing[j].Key })
+	return report, nil
+}
+
+// storageReferences собирает все ключи хранилища, на которые ссылается база,
+// вместе с записью, которая на них ссылается
+func storageReferences() (map[string]MissingImage, error) {
+	references := map[string]MissingImage{}
+	add := func(key string, reference MissingImage) {
+		if key == "" {
+			return
+		}
+		reference.Key = key
+		references[key] = reference
+	}
+
+	var comics []Comics
+	err := models.Database.Unscoped().
+		Select("id, image_path, banner_path, image_variants, banner_variants").
+		Find(&comics).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, comic := range comics {
+		add(comic.ImagePath, MissingImage{Kind: "cover", ComicsID: comic.ID})
+		add(comic.BannerPath, MissingImage{Kind: "banner", ComicsID: comic.ID})
+		for _, variant := range comic.ImageVariants {
+			add(imaging.VariantKey(comic.ImagePath, variant.Name, variant.Format), MissingImage{Kind: "cover_variant", ComicsID: comic.ID})
+		}
+		for _, variant := range comic.BannerVariants {
+			add(imaging.VariantKey(comic.BannerPath, variant.Name, variant.Format), MissingImage{Kind: "banner_variant", ComicsID: comic.ID})
+		}
+	}
+
+	var pages []struct {
+		ID        uint
+		ChapterID uint
+		ComicsID  uint
+		FilePath  string
+	}
+	err = models.Database.Table("pages").
+		Select("pages.id, pages.chapter_id, chapters.comics_id, pages.file_path").
+		Joins("JOIN chapters ON chapters.id = pages.chapter_id").
+		Scan(&pages).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, page := range pages {
+		add(page.FilePath, MissingImage{Kind: "page", ComicsID: page.ComicsID, ChapterID: page.ChapterID, PageID: page.ID})
+	}
+	return references, nil
+}
+
+// DeleteOrphans удаляет из хранилища объекты из отчёта, на которые нет ссылок.
+// Возвращает число удалённых объектов; отсутствующие объекты пропускаются.
+func DeleteOrphans(report *IntegrityReport) (int, error) {
+	deleted := 0
+	for _, orphan := range report.Orphans {
+		if err := storage.Default.Delete(orphan.Key); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// MarkBroken выставляет признак broken комиксам без обложки или баннера и страницам
+// без файла, а у записей, файлы которых снова на месте, снимает его.
+// Отсутствие уменьшенных копий запись не портит: обложка отдаётся и без них.
+func MarkBroken(report *IntegrityReport) (comics, pages int, err error) {
+	var brokenComics, brokenPages []uint
+	for _, missing := range report.Missing {
+		switch missing.Kind {
+		case "cover", "banner":
+			brokenComics = append(brokenComics, missing.ComicsID)
+		case "page":
+			brokenPages = append(brokenPages, missing.PageID)
+		}
+	}
+
+	err = models.Database.Transaction(func(tx *gorm.DB) error {
+		// Признаки пересчитываются целиком, поэтому сначала снимаются со всех записей.
+		// UpdateColumn не трогает updated_at: каталог сортируется по нему.
+		if err := tx.Unscoped().Model(&Comics{}).Where("broken").UpdateColumn("broken", false).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Page{}).Where("broken").UpdateColumn("broken", false).Error; err != nil {
+			return err
+		}
+
+		if len(brokenComics) > 0 {
+			result := tx.Unscoped().Model(&Comics{}).Where("id IN ?", brokenComics).UpdateColumn("broken", true)
+			if result.Error != nil {
+				return result.Error
+			}
+			comics = int(result.RowsAffected)
+		}
+		if len(brokenPages) > 0 {
+			result := tx.Model(&Page{}).Where("id IN ?", brokenPages).UpdateColumn("broken", true)
+			if result.Error != nil {
+				return result.Error
+			}
+			pages = int(result.RowsAffected)
+		}
+		return nil
+	})
+	return comics, pages, err
+}
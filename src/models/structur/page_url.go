@@ -0,0 +1,131 @@
+package structur
+
+import (
+	"errors"
+	"main/src/imaging"
+	"main/src/models"
+	"main/src/storage"
+	"main/src/utils"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultPageURLTTL - сколько действует адрес страницы, выданный при открытии главы
+const DefaultPageURLTTL = time.Hour
+
+// PageURLTTL - срок действия подписанных адресов страниц, переменная окружения PAGE_URL_TTL
+func PageURLTTL() time.Duration {
+	return utils.GetDurationEnv("PAGE_URL_TTL", DefaultPageURLTTL)
+}
+
+// PageURLBindUser сообщает, привязываются ли адреса страниц к вошедшему пользователю,
+// переменная окружения PAGE_URL_BIND_USER. Привязанный адрес принимается только
+// с токеном того же пользователя, поэтому клиент запрашивает страницы с заголовком Authorization.
+func PageURLBindUser() bool {
+	return utils.GetEnv("PAGE_URL_BIND_USER", "false") == "true"
+}
+
+// ImageInfo - как раздаётся изображение
+type ImageInfo struct {
+	Public   bool             // Раздаётся без подписи
+	Variants imaging.Variants // Сохранённые варианты, если ключ указывает на обложку или баннер
+}
+
+// LookupImage находит комикс, которому принадлежит изображение: первый сегмент ключа - его slug.
+// Без подписи раздаются только обложки и баннеры видимого комикса и их варианты. Остальные ключи,
+// в том числе страницы глав, изображения скрытых комиксов и комиксов в корзине и всё,
+// что не удалось сопоставить с комиксом, раздаются только по подписанным адресам.
+func LookupImage(key string) (ImageInfo, error) {
+	slug, _, ok := strings.Cut(key, "/")
+	if !ok {
+		return ImageInfo{}, nil
+	}
+
+	// Комиксы в корзине тоже владеют своими изображениями
+	var comic Comics
+	err := models.Database.Unscoped().
+		Select("id, image_path, banner_path, image_variants, banner_variants, hidden, deleted_at").
+		Where("alternative_name = ?", slug).
+		Take(&comic).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ImageInfo{}, nil
+	} else if err != nil {
+		return ImageInfo{}, err
+	}
+	visible := !comic.Hidden && !comic.DeletedAt.Valid
+
+	switch key {
+	case "":
+	case comic.ImagePath:
+		return ImageInfo{Public: visible, Variants: comic.ImageVariants}, nil
+	case comic.BannerPath:
+		return ImageInfo{Public: visible, Variants: comic.BannerVariants}, nil
+	}
+
+	// Варианты "<ключ без расширения>-card.webp" сравниваются по ключу оригинала
+	if base, ok := imaging.DerivedBase(key); ok {
+		for _, source := range []string{comic.ImagePath, comic.BannerPath} {
+			if source != "" && base == strings.TrimSuffix(source, path.Ext(source)) {
+				return ImageInfo{Public: visible}, nil
+			}
+		}
+	}
+	return ImageInfo{}, nil
+}
+
+// signedExpiry - срок действия нового подписанного адреса. Срок округляется вверх до четверти PageURLTTL,
+// чтобы повторные открытия главы получали те же адреса и страницы брались из кэша браузера.
+func signedExpiry() time.Time {
+	ttl := PageURLTTL()
+	expires := time.Now().Add(ttl)
+	if window := ttl / 4; window >= time.Second {
+		expires = expires.Truncate(window).Add(window)
+	}
+	return expires
+}
+
+// pageURL подписывает адрес страницы
+func pageURL(key string, userID uint) string {
+	return storage.SignedURL(key, userID, signedExpiry())
+}
+
+// imageURL - адрес обложки, баннера или их варианта. Изображения скрытых комиксов и комиксов
+// в корзине подписываются: адрес получают только те, кому показан сам комикс.
+func imageURL(key string, private bool) string {
+	if private {
+		return pageURL(key, 0)
+	}
+	return storage.URL(key)
+}
+
+// signedUser - пользователь, к которому привязываются адреса. Анонимным читателям
+// и при выключенной привязке адреса не привязываются к пользователю.
+func signedUser(userID uint) uint {
+	if !PageURLBindUser() {
+		return 0
+	}
+	return userID
+}
+
+// SignPages выдаёт страницам главы адреса для пользователя userID
+func (chapter *Chapter) SignPages(userID uint) {
+	userID = signedUser(userID)
+	for i := range chapter.Pages {
+		chapter.Pages[i].URL = pageURL(chapter.Pages[i].FilePath, userID)
+	}
+}
+
+// ExportKey - ключ, которым подписывается адрес скачивания главы архивом.
+// Он не совпадает ни с одним ключом изображения, поэтому подпись архива не открывает страницы и наоборот.
+func ExportKey(slug string, chapterID uint) string {
+	return storage.Key("export", slug, strconv.FormatUint(uint64(chapterID), 10))
+}
+
+// SignExport возвращает параметры подписи для скачивания главы архивом пользователем userID
+func (chapter *Chapter) SignExport(slug string, userID uint) string {
+	return storage.SignedQuery(ExportKey(slug, chapter.ID), signedUser(userID), signedExpiry())
+}
@@ -0,0 +1,160 @@
+package structur
+
+import (
+	"errors"
+	"main/src/storage"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// signedQuery разбирает параметры подписанного адреса
+func signedQuery(t *testing.T, address string) url.Values {
+	t.Helper()
+	parsed, err := url.Parse(address)
+	if err != nil {
+		t.Fatalf("parse %q: %v", address, err)
+	}
+	return parsed.Query()
+}
+
+func TestSignedExpiry(t *testing.T) {
+	tests := []struct {
+		name   string
+		ttl    string
+		window time.Duration // Шаг округления срока, 0 - без округления
+	}{
+		{name: "hour", ttl: "1h", window: 15 * time.Minute},
+		{name: "four seconds", ttl: "4s", window: time.Second},
+		{name: "too short to round", ttl: "2s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PAGE_URL_TTL", tt.ttl)
+			ttl, _ := time.ParseDuration(tt.ttl)
+
+			before := time.Now()
+			expires := signedExpiry()
+			after := time.Now()
+
+			if expires.Before(before.Add(ttl).Truncate(time.Second)) {
+				t.Errorf("expires %v is earlier than now + %v", expires, ttl)
+			}
+			if limit := after.Add(ttl + tt.window); expires.After(limit) {
+				t.Errorf("expires %v is later than %v", expires, limit)
+			}
+			if tt.window > 0 && !expires.Equal(expires.Truncate(tt.window)) {
+				t.Errorf("expires %v is not rounded to %v", expires, tt.window)
+			}
+		})
+	}
+}
+
+func TestSignPages(t *testing.T) {
+	tests := []struct {
+		name     string
+		bindUser string
+		userID   uint
+		wantUID  uint
+	}{
+		{name: "anonymous", bindUser: "true", userID: 0, wantUID: 0},
+		{name: "bound to reader", bindUser: "true", userID: 42, wantUID: 42},
+		{name: "binding disabled", bindUser: "false", userID: 42, wantUID: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PAGE_URL_BIND_USER", tt.bindUser)
+			chapter := Chapter{Pages: []Page{
+				{FilePath: "berserk/chapters/1/001.jpg"},
+				{FilePath: "berserk/chapters/1/002.jpg"},
+			}}
+			chapter.SignPages(tt.userID)
+
+			for _, page := range chapter.Pages {
+				query := signedQuery(t, page.URL)
+				userID, err := storage.VerifySignature(page.FilePath, query)
+				if err != nil {
+					t.Fatalf("verify %s: %v", page.URL, err)
+				}
+				if userID != tt.wantUID {
+					t.Errorf("signed for user %d, want %d", userID, tt.wantUID)
+				}
+
+				// Подпись одной страницы не открывает другую
+				if _, err := storage.VerifySignature("berserk/chapters/1/003.jpg", query); !errors.Is(err, storage.ErrSignatureInvalid) {
+					t.Errorf("signature of %s accepted for another page: %v", page.FilePath, err)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifySignatureTampering(t *testing.T) {
+	const key = "berserk/chapters/1/001.jpg"
+	valid := signedQuery(t, storage.SignedURL(key, 7, time.Now().Add(time.Hour)))
+
+	tests := []struct {
+		name   string
+		modify func(query url.Values)
+		want   error
+	}{
+		{name: "untouched", modify: func(url.Values) {}},
+		{name: "another user", modify: func(query url.Values) { query.Set("uid", "8") }, want: storage.ErrSignatureInvalid},
+		{name: "binding removed", modify: func(query url.Values) { query.Del("uid") }, want: storage.ErrSignatureInvalid},
+		{name: "extended", modify: func(query url.Values) { query.Set("expires", "99999999999") }, want: storage.ErrSignatureInvalid},
+		{name: "no signature", modify: func(query url.Values) { query.Del("sig") }, want: storage.ErrSignatureInvalid},
+		{name: "no expiry", modify: func(query url.Values) { query.Del("expires") }, want: storage.ErrSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{}
+			for name, values := range valid {
+				query[name] = append([]string(nil), values...)
+			}
+			tt.modify(query)
+
+			if _, err := storage.VerifySignature(key, query); !errors.Is(err, tt.want) {
+				t.Errorf("VerifySignature() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignedURLExpired(t *testing.T) {
+	const key = "berserk/chapters/1/001.jpg"
+	query := signedQuery(t, storage.SignedURL(key, 0, time.Now().Add(-time.Minute)))
+	if _, err := storage.VerifySignature(key, query); !errors.Is(err, storage.ErrSignatureExpired) {
+		t.Errorf("VerifySignature() error = %v, want %v", err, storage.ErrSignatureExpired)
+	}
+}
+
+func TestSignExport(t *testing.T) {
+	t.Setenv("PAGE_URL_BIND_USER", "true")
+	chapter := Chapter{ID: 5}
+	query, err := url.ParseQuery(chapter.SignExport("berserk", 42))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  string
+		want error
+	}{
+		{name: "export of this chapter", key: ExportKey("berserk", 5)},
+		{name: "export of another chapter", key: ExportKey("berserk", 6), want: storage.ErrSignatureInvalid},
+		{name: "export of another comic", key: ExportKey("vagabond", 5), want: storage.ErrSignatureInvalid},
+		{name: "page of the chapter", key: "berserk/chapters/5/001.jpg", want: storage.ErrSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID, err := storage.VerifySignature(tt.key, query)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("VerifySignature(%q) error = %v, want %v", tt.key, err, tt.want)
+			}
+			if err == nil && userID != 42 {
+				t.Errorf("signed for user %d, want 42", userID)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package structur
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"main/src/models"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ComicsSnapshot - редактируемые метаданные комикса на момент ревизии
+type ComicsSnapshot struct {
+	Name           string     `json:"name"`
+	Description    string     `json:"description"`
+	Rating         float32    `json:"rating"`
+	Type           ComicsType `json:"type_comics"`
+	Author         string     `json:"author"`
+	Artist         string     `json:"original_author"`
+	Year           int        `json:"year"`
+	IsFinished     bool       `json:"is_finished"`
+	Pegi           PegiType   `json:"pegi"`
+	Status         StatusType `json:"status"`
+	TransferStatus StatusType `json:"transfer_status"`
+	Hidden         bool       `json:"hidden"`
+	PublishedOn    time.Time  `json:"published_on"`
+	Tags           []string   `json:"tags"`
+	Genres         []string   `json:"genres"`
+}
+
+// FieldChange - значение поля до и после изменения
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+type RevisionChanges map[string]FieldChange
+
+type ComicRevision struct {
+	ID           uint            `json:"id" gorm:"primaryKey"`
+	ComicsID     uint            `json:"comics_id" gorm:"index"`
+	Version      uint            `json:"version"` // Версия комикса после изменения
+	UserID       uint            `json:"user_id"` // 0 - изменение из консольной команды
+	Changes      RevisionChanges `json:"changes" gorm:"type:jsonb;serializer:json"`
+	Snapshot     ComicsSnapshot  `json:"snapshot" gorm:"type:jsonb;serializer:json"`
+	RestoredFrom *uint           `json:"restored_from,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+func snapshotOf(comic *Comics) ComicsSnapshot {
+	return ComicsSnapshot{
+		Name:           comic.Name,
+		Description:    comic.Description,
+		Rating:         comic.Rating,
+		Type:           comic.Type,
+		Author:         comic.Author,
+		Artist:         comic.Artist,
+		Year:           comic.Year,
+		IsFinished:     comic.IsFinished,
+		Pegi:           comic.Pegi,
+		Status:         comic.Status,
+		TransferStatus: comic.TransferStatus,
+		Hidden:         comic.Hidden,
+		PublishedOn:    comic.PublishedOn,
+		Tags:           append([]string{}, comic.Tags...),
+		Genres:         append([]string{}, comic.Genres...),
+	}
+}
+
+// update превращает снимок в ComicsUpdate со всеми полями для восстановления
+func (snapshot ComicsSnapshot) update() *ComicsUpdate {
+	return &ComicsUpdate{
+		Name:           &snapshot.Name,
+		Description:    &snapshot.Description,
+		Rating:         &snapshot.Rating,
+		Type:           &snapshot.Type,
+		Author:         &snapshot.Author,
+		Artist:         &snapshot.Artist,
+		Year:           &snapshot.Year,
+		IsFinished:     &snapshot.IsFinished,
+		Pegi:           &snapshot.Pegi,
+		Status:         &snapshot.Status,
+		TransferStatus: &snapshot.TransferStatus,
+		Hidden:         &snapshot.Hidden,
+		PublishedOn:    &snapshot.PublishedOn,
+		Tags:           &snapshot.Tags,
+		Genres:         &snapshot.Genres,
+	}
+}
+
+// diffSnapshots сравнивает снимки по JSON представлению полей
+func diffSnapshots(before, after ComicsSnapshot) (RevisionChanges, error) {
+	toMap := func(snapshot ComicsSnapshot) (map[string]interface{}, error) {
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			return nil, err
+		}
+		fields := map[string]interface{}{}
+		return fields, json.Unmarshal(data, &fields)
+	}
+
+	old, err := toMap(before)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := toMap(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := RevisionChanges{}
+	for field, value := range updated {
+		if !reflect.DeepEqual(old[field], value) {
+			changes[field] = FieldChange{Old: old[field], New: value}
+		}
+	}
+	return changes, nil
+}
+
+// recordRevision сохраняет ревизию, если метаданные комикса изменились.
+// before - состояние до изменения (nil при создании), after - после.
+func recordRevision(tx *gorm.DB, before, after *Comics, userID uint, restoredFrom *uint) error {
+	var previous ComicsSnapshot
+	if before != nil {
+		previous = snapshotOf(before)
+	}
+	current := snapshotOf(after)
+
+	changes, err := diffSnapshots(previous, current)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 && before != nil {
+		return nil
+	}
+
+	revision := ComicRevision{
+		ComicsID:     after.ID,
+		Version:      after.Version,
+		UserID:       userID,
+		Changes:      changes,
+		Snapshot:     current,
+		RestoredFrom: restoredFrom,
+	}
+	return tx.Create(&revision).Error
+}
+
+func GetComicRevisions(comicsID uint, limit, offset int) ([]ComicRevision, error) {
+	revisions := make([]ComicRevision, 0, limit)
+	err := models.Database.Where("comics_id = ?", comicsID).
+		Order("id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&revisions).Error
+	if err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// RestoreComicRevision возвращает метаданные комикса к состоянию указанной ревизии.
+// Восстановление записывается как новая ревизия.
+func RestoreComicRevision(slug string, revisionID uint, userID uint) (*Comics, error) {
+	comic, err := GetComicsBySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	var revision ComicRevision
+	err = models.Database.Where("comics_id = ? AND id = ?", comic.ID, revisionID).First(&revision).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("revision %d not found: %w", revisionID, err)
+		}
+		return nil, err
+	}
+
+	before := *comic
+	err = models.Database.Transaction(func(tx *gorm.DB) error {
+		updatedFields := revision.Snapshot.update().columns()
+		updatedFields["version"] = gorm.Expr("version + 1")
+
+		result := tx.Model(comic).Where("version = ?", before.Version).Updates(updatedFields)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrVersionMismatch
+		}
+
+		if err := tx.First(comic, comic.ID).Error; err != nil {
+			return err
+		}
+		return recordRevision(tx, &before, comic, userID, &revision.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return comic, nil
+}
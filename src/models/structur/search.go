@@ -0,0 +1,207 @@
+package structur
+
+import (
+	"main/src/imaging"
+	"main/src/models"
+	"main/src/utils"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DefaultSearchLimit  = 20
+	MaxSearchLimit      = 50
+	DefaultSuggestLimit = 8
+	MaxSuggestLimit     = 20
+)
+
+type SearchResult struct {
+	Comics
+	Rank float64 `json:"rank"`
+}
+
+type Suggestion struct {
+	ID              uint             `json:"id"`
+	Name            string           `json:"name"`
+	AlternativeName string           `json:"alternative_name"`
+	ImagePath       string           `json:"-"`
+	ImageURL        string           `json:"image_url" gorm:"-"`
+	ImageVariants   imaging.Variants `json:"image_variants"`
+	Hidden          bool             `json:"-"`
+	Highlight       string           `json:"highlight"` // Название с совпадениями в <mark></mark>
+}
+
+// searchQuery - поисковая строка в вариантах для разных алфавитов
+type searchQuery struct {
+	Text     string // Как ввёл пользователь, в нижнем регистре
+	Cyrillic string // Латиница переведена в кириллицу
+	Latin    string // Кириллица переведена в латиницу, как в alternative_name
+	Prefix   string // Префиксный tsquery для подсказок и подсветки
+}
+
+func newSearchQuery(text string) searchQuery {
+	text = strings.ToLower(strings.Join(strings.Fields(text), " "))
+	query := searchQuery{
+		Text:     text,
+		Cyrillic: utils.ToCyrillic(text),
+		Latin:    utils.ToLatin(text),
+	}
+
+	// Префиксный запрос: (слово1:* & слово2:*) | (слово1 в кириллице:* & ...)
+	var variants []string
+	seen := map[string]bool{}
+	for _, variant := range []string{query.Text, query.Cyrillic, query.Latin} {
+		if tsquery := prefixTsquery(variant); tsquery != "" && !seen[tsquery] {
+			seen[tsquery] = true
+			variants = append(variants, "("+tsquery+")")
+		}
+	}
+	query.Prefix = strings.Join(variants, " | ")
+	return query
+}
+
+// prefixTsquery строит tsquery вида "слово1:* & слово2:*", отбрасывая служебные символы
+func prefixTsquery(text string) string {
+	var terms []string
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		terms = append(terms, word+":*")
+	}
+	return strings.Join(terms, " & ")
+}
+
+// Условие совпадения: полнотекстовый поиск с русским и английским стеммингом
+// по исходному запросу и его транслитерации, либо нечёткое совпадение триграммами
+const searchMatchSQL = `(
+	search_vector @@ websearch_to_tsquery('russian', @text)
+	OR search_vector @@ websearch_to_tsquery('english', @text)
+	OR search_vector @@ websearch_to_tsquery('russian', @cyrillic)
+	OR search_vector @@ websearch_to_tsquery('english', @latin)
+	OR lower(name) % @text
+	OR lower(name) % @cyrillic
+	OR alternative_name % @latin
+	OR @text <% lower(name)
+	OR @cyrillic <% lower(name)
+)`
+
+const searchRankSQL = `(
+	ts_rank(search_vector, websearch_to_tsquery('russian', @text))
+	+ ts_rank(search_vector, websearch_to_tsquery('english', @text))
+	+ ts_rank(search_vector, websearch_to_tsquery('russian', @cyrillic))
+	+ ts_rank(search_vector, websearch_to_tsquery('english', @latin))
+	+ 2 * GREATEST(
+		similarity(lower(name), @text),
+		similarity(lower(name), @cyrillic),
+		similarity(alternative_name, @latin),
+		word_similarity(@text, lower(name)),
+		word_similarity(@cyrillic, lower(name))
+	)
+)`
+
+func (query searchQuery) params() map[string]interface{} {
+	return map[string]interface{}{
+		"text":     query.Text,
+		"cyrillic": query.Cyrillic,
+		"latin":    query.Latin,
+		"prefix":   query.Prefix,
+	}
+}
+
+// SearchComics ищет комиксы по названию, альтернативному названию и описанию.
+// Поддерживаются опечатки и ввод названия в другой раскладке транслитом.
+func SearchComics(text string, limit, offset int, includeHidden bool) ([]SearchResult, error) {
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	results := make([]SearchResult, 0, limit)
+	query := newSearchQuery(text)
+	if query.Text == "" {
+		return results, nil
+	}
+
+	db := models.Database.Model(&Comics{}).
+		Select("comics.*, "+searchRankSQL+" AS rank", query.params()).
+		Where(searchMatchSQL, query.params())
+	if !includeHidden {
+		db = db.Where("hidden = ?", false)
+	}
+
+	err := db.Order("rank DESC, id").Limit(limit).Offset(offset).Scan(&results).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Scan не вызывает AfterFind, поэтому адреса изображений заполняем сами
+	for i := range results {
+		results[i].fillURLs()
+	}
+	return results, nil
+}
+
+// SuggestComics возвращает подсказки для автодополнения с подсвеченными совпадениями
+func SuggestComics(text string, limit int, includeHidden bool) ([]Suggestion, error) {
+	if limit <= 0 {
+		limit = DefaultSuggestLimit
+	}
+	if limit > MaxSuggestLimit {
+		limit = MaxSuggestLimit
+	}
+
+	suggestions := make([]Suggestion, 0, limit)
+	query := newSearchQuery(text)
+	if query.Prefix == "" {
+		return suggestions, nil
+	}
+
+	// Для подсказок важнее совпадение начала слов, поэтому к общему условию
+	// добавляется префиксный поиск по названиям
+	db := models.Database.Model(&Comics{}).
+		Select(`id, name, alternative_name, image_path, image_variants, hidden,
+			ts_headline('simple', name, to_tsquery('simple', @prefix), 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true') AS highlight`,
+			query.params()).
+		Where("(to_tsvector('simple', name || ' ' || replace(alternative_name, '-', ' ')) @@ to_tsquery('simple', @prefix) OR "+searchMatchSQL+")", query.params())
+	if !includeHidden {
+		db = db.Where("hidden = ?", false)
+	}
+
+	err := db.Clauses(clause.OrderBy{Expression: clause.NamedExpr{
+		SQL:  `(to_tsvector('simple', name || ' ' || replace(alternative_name, '-', ' ')) @@ to_tsquery('simple', @prefix)) DESC, ` + searchRankSQL + ` DESC, views DESC`,
+		Vars: []interface{}{query.params()},
+	}}).
+		Limit(limit).
+		Scan(&suggestions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range suggestions {
+		suggestions[i].ImageURL = imageURL(suggestions[i].ImagePath, suggestions[i].Hidden)
+		fillVariantURLs(suggestions[i].ImagePath, suggestions[i].ImageVariants, suggestions[i].Hidden)
+	}
+	return suggestions, nil
+}
+
+// migrateSearch создаёт колонку полнотекстового поиска и индексы для нечёткого поиска
+func migrateSearch() {
+	models.Database.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm")
+	models.Database.Exec(`ALTER TABLE comics ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+		setweight(to_tsvector('russian', coalesce(name, '')), 'A')
+		|| setweight(to_tsvector('english', coalesce(name, '')), 'A')
+		|| setweight(to_tsvector('simple', replace(coalesce(alternative_name, ''), '-', ' ')), 'A')
+		|| setweight(to_tsvector('russian', coalesce(description, '')), 'C')
+		|| setweight(to_tsvector('english', coalesce(description, '')), 'C')
+	) STORED`)
+	models.Database.Exec("CREATE INDEX IF NOT EXISTS idx_comics_search_vector ON comics USING GIN (search_vector)")
+	models.Database.Exec("CREATE INDEX IF NOT EXISTS idx_comics_name_trgm ON comics USING GIN (lower(name) gin_trgm_ops)")
+	models.Database.Exec("CREATE INDEX IF NOT EXISTS idx_comics_alternative_name_trgm ON comics USING GIN (alternative_name gin_trgm_ops)")
+}
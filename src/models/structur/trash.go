@@ -0,0 +1,154 @@
+package structur
+
+import (
+	"fmt"
+	"log"
+	"main/src/models"
+	"main/src/storage"
+	"main/src/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultTrashRetention     = 30 * 24 * time.Hour
+	DefaultTrashPurgeInterval = time.Hour
+)
+
+// TrashRetention - сколько комикс хранится в корзине до окончательного удаления.
+// Настраивается переменной окружения COMICS_TRASH_RETENTION, например "720h".
+func TrashRetention() time.Duration {
+	return utils.GetDurationEnv("COMICS_TRASH_RETENTION", DefaultTrashRetention)
+}
+
+// TrashedComic - комикс в корзине с датой окончательного удаления
+type TrashedComic struct {
+	Comics
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+// GetTrashedComics возвращает комиксы из корзины, начиная с недавно удалённых
+func GetTrashedComics(limit, offset int) ([]TrashedComic, error) {
+	comics := make([]Comics, 0, limit)
+	err := models.Database.Unscoped().
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at DESC, id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&comics).Error
+	if err != nil {
+		return nil, err
+	}
+
+	retention := TrashRetention()
+	trashed := make([]TrashedComic, 0, len(comics))
+	for _, comic := range comics {
+		trashed = append(trashed, TrashedComic{Comics: comic, PurgeAt: comic.DeletedAt.Time.Add(retention)})
+	}
+	return trashed, nil
+}
+
+// RestoreComicBySlug возвращает комикс из корзины
+func RestoreComicBySlug(slug string) (*Comics, error) {
+	var comic Comics
+	err := models.Database.Unscoped().
+		Where("alternative_name = ? AND deleted_at IS NOT NULL", slug).
+		First(&comic).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = models.Database.Unscoped().Model(&comic).Updates(map[string]interface{}{
+		"deleted_at": nil,
+		"version":    gorm.Expr("version + 1"),
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore comic: %w", err)
+	}
+
+	if err := models.Database.First(&comic, comic.ID).Error; err != nil {
+		return nil, err
+	}
+	return &comic, nil
+}
+
+// PurgeTrash окончательно удаляет комиксы, пролежавшие в корзине дольше retention,
+// вместе с главами, страницами, ревизиями и изображениями.
+// Возвращает количество удалённых комиксов.
+func PurgeTrash(retention time.Duration) (int, error) {
+	var comics []Comics
+	err := models.Database.Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", time.Now().Add(-retention)).
+		Find(&comics).Error
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, comic := range comics {
+		deleted, err := purgeComic(&comic)
+		if err != nil {
+			return purged, fmt.Errorf("failed to purge comic %q: %w", comic.AlternativeName, err)
+		}
+		if deleted {
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// purgeComic удаляет комикс из корзины. Возвращает false, если его уже восстановили.
+func purgeComic(comic *Comics) (bool, error) {
+	restored := false
+	err := models.Database.Transaction(func(tx *gorm.DB) error {
+		// Комикс мог быть восстановлен после выборки, поэтому удаляем только из корзины
+		result := tx.Unscoped().Where("deleted_at IS NOT NULL").Delete(comic)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			restored = true
+			return nil
+		}
+
+		chapterIDs := tx.Model(&Chapter{}).Select("id").Where("comics_id = ?", comic.ID)
+		if err := tx.Where("chapter_id IN (?)", chapterIDs).Delete(&Page{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("comics_id = ?", comic.ID).Delete(&Chapter{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("comics_id = ?", comic.ID).Delete(&ComicRevision{}).Error
+	})
+	if err != nil || restored {
+		return false, err
+	}
+
+	// Удаление изображений комикса из хранилища
+	if err := storage.Default.DeletePrefix(comic.AlternativeName); err != nil {
+		return true, fmt.Errorf("failed to delete images: %w", err)
+	}
+	return true, nil
+}
+
+// StartTrashPurger периодически очищает корзину в фоне.
+// Интервал задаётся переменной окружения COMICS_TRASH_PURGE_INTERVAL.
+func StartTrashPurger() {
+	interval := utils.GetDurationEnv("COMICS_TRASH_PURGE_INTERVAL", DefaultTrashPurgeInterval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			purged, err := PurgeTrash(TrashRetention())
+			if err != nil {
+				log.Printf("Trash purge failed: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d comics from trash", purged)
+			}
+			<-ticker.C
+		}
+	}()
+}
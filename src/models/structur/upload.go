@@ -0,0 +1,373 @@
+package structur
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"main/src/models"
+	"main/src/utils"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DefaultUploadExpiry        = 24 * time.Hour
+	DefaultUploadPurgeInterval = time.Hour
+	DefaultUploadMaxSize       = 1 << 30
+	DefaultUploadMaxActive     = 5
+	DefaultUploadMaxReserved   = 4 << 30
+)
+
+var (
+	ErrUploadExpired        = errors.New("upload has expired")
+	ErrUploadOffsetMismatch = errors.New("upload offset does not match")
+	ErrUploadTooLarge       = errors.New("upload is larger than the maximum size")
+	ErrUploadIncomplete     = errors.New("upload is not complete")
+	ErrUploadLocked         = errors.New("upload is being written by another request")
+	ErrUploadQuotaExceeded  = errors.New("too many active uploads, finish or delete some of them first")
+)
+
+// Upload - загрузка по протоколу tus. Данные копятся во временном файле на диске,
+// а завершённая загрузка используется вместо файла формы при создании комикса или импорте главы.
+//
+// Файлы загрузок лежат на локальном диске, а запись одного куска защищена блокировкой в памяти процесса,
+// поэтому загрузки работают только при одном экземпляре сервера (или когда все запросы /uploads
+// одного пользователя попадают на один экземпляр и UPLOADS_DIR у них общий). Хранилище изображений
+// (в том числе S3) для загрузок не используется.
+type Upload struct {
+	ID          string    `json:"id" gorm:"primaryKey;size:32"`
+	UserID      uint      `json:"user_id" gorm:"index"`
+	Length      int64     `json:"length"`
+	Offset      int64     `json:"offset" gorm:"column:upload_offset"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Metadata    string    `json:"-"` // Upload-Metadata в том виде, как его прислал клиент
+	ExpiresAt   time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Complete сообщает, что получены все байты загрузки
+func (upload *Upload) Complete() bool {
+	return upload.Offset == upload.Length
+}
+
+// UploadsDir - директория для незавершённых загрузок, переменная окружения UPLOADS_DIR.
+// Загрузка дописывается кусками, поэтому хранится на локальном диске, а не в хранилище изображений.
+func UploadsDir() string {
+	return utils.GetEnv("UPLOADS_DIR", "./main/uploads")
+}
+
+// UploadExpiry - сколько хранится загрузка после последнего полученного куска,
+// переменная окружения UPLOAD_EXPIRY
+func UploadExpiry() time.Duration {
+	return utils.GetDurationEnv("UPLOAD_EXPIRY", DefaultUploadExpiry)
+}
+
+// UploadMaxSize - максимальный размер одной загрузки в байтах, переменная окружения UPLOAD_MAX_SIZE
+func UploadMaxSize() int64 {
+	size, err := strconv.ParseInt(utils.GetEnv("UPLOAD_MAX_SIZE", ""), 10, 64)
+	if err != nil || size <= 0 {
+		return DefaultUploadMaxSize
+	}
+	return size
+}
+
+// UploadMaxActive - сколько незавершённых и неиспользованных загрузок может быть у одного пользователя,
+// переменная окружения UPLOAD_MAX_ACTIVE
+func UploadMaxActive() int64 {
+	count, err := strconv.ParseInt(utils.GetEnv("UPLOAD_MAX_ACTIVE", ""), 10, 64)
+	if err != nil || count <= 0 {
+		return DefaultUploadMaxActive
+	}
+	return count
+}
+
+// UploadMaxReserved - сколько байт в сумме могут занимать загрузки одного пользователя
+// (считается заявленная длина, а не полученная часть), переменная окружения UPLOAD_MAX_RESERVED
+func UploadMaxReserved() int64 {
+	size, err := strconv.ParseInt(utils.GetEnv("UPLOAD_MAX_RESERVED", ""), 10, 64)
+	if err != nil || size <= 0 {
+		return DefaultUploadMaxReserved
+	}
+	return size
+}
+
+func (upload *Upload) path() string {
+	return filepath.Join(UploadsDir(), upload.ID)
+}
+
+// parseUploadMetadata разбирает заголовок Upload-Metadata: пары "ключ base64(значение)" через запятую
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("invalid Upload-Metadata value for %q", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// CreateUpload регистрирует новую загрузку длиной length байт и создаёт для неё пустой файл
+func CreateUpload(userID uint, length int64, metadataHeader string) (*Upload, error) {
+	if length < 0 {
+		return nil, errors.New("upload length must not be negative")
+	}
+	if length > UploadMaxSize() {
+		return nil, ErrUploadTooLarge
+	}
+	metadata, err := parseUploadMetadata(metadataHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	upload := &Upload{
+		ID:          hex.EncodeToString(id),
+		UserID:      userID,
+		Length:      length,
+		Filename:    filepath.Base(metadata["filename"]),
+		ContentType: metadata["filetype"],
+		Metadata:    metadataHeader,
+		ExpiresAt:   time.Now().Add(UploadExpiry()),
+	}
+
+	if err := os.MkdirAll(UploadsDir(), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(upload.path(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+
+	err = models.Database.Transaction(func(tx *gorm.DB) error {
+		// Строка пользователя блокируется, чтобы параллельные запросы не обошли ограничения
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.User{}, userID).Error; err != nil {
+			return err
+		}
+		var active struct {
+			Count    int64
+			Reserved int64
+		}
+		err := tx.Model(&Upload{}).
+			Select("COUNT(*) AS count, COALESCE(SUM(length), 0) AS reserved").
+			Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+			Scan(&active).Error
+		if err != nil {
+			return err
+		}
+		if active.Count >= UploadMaxActive() || active.Reserved+length > UploadMaxReserved() {
+			return ErrUploadQuotaExceeded
+		}
+		return tx.Create(upload).Error
+	})
+	if err != nil {
+		os.Remove(upload.path())
+		return nil, err
+	}
+	return upload, nil
+}
+
+// GetUpload возвращает загрузку пользователя. Чужие загрузки не отличаются от несуществующих.
+func GetUpload(id string, userID uint) (*Upload, error) {
+	var upload Upload
+	if err := models.Database.Where("id = ? AND user_id = ?", id, userID).First(&upload).Error; err != nil {
+		return nil, err
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		return nil, ErrUploadExpired
+	}
+	return &upload, nil
+}
+
+// Один кусок загрузки пишет только один запрос. Блокировка берётся только
+// для существующих загрузок, чтобы запросы с выдуманными id не копили записи.
+var uploadLocks sync.Map
+
+func lockUpload(id string) (func(), bool) {
+	value, _ := uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	mutex := value.(*sync.Mutex)
+	if !mutex.TryLock() {
+		return nil, false
+	}
+	return mutex.Unlock, true
+}
+
+// WriteUpload дописывает данные из body, начиная с offset. offset должен совпадать с числом
+// уже полученных байт. При обрыве соединения полученная часть сохраняется, и клиент
+// продолжает с нового смещения. Возвращает загрузку с обновлённым смещением.
+func WriteUpload(id string, userID uint, offset int64, body io.Reader) (*Upload, error) {
+	if _, err := GetUpload(id, userID); err != nil {
+		return nil, err
+	}
+	unlock, ok := lockUpload(id)
+	if !ok {
+		return nil, ErrUploadLocked
+	}
+	defer unlock()
+
+	// Смещение перечитывается под блокировкой
+	upload, err := GetUpload(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if offset != upload.Offset {
+		return upload, ErrUploadOffsetMismatch
+	}
+
+	file, err := os.OpenFile(upload.path(), os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Отбрасываем байты, дописанные после последнего учтённого смещения, например при падении процесса
+	if err := file.Truncate(upload.Offset); err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(upload.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	written, copyErr := io.Copy(file, io.LimitReader(body, upload.Length-upload.Offset))
+	if err := file.Sync(); err != nil {
+		return nil, err
+	}
+
+	upload.Offset += written
+	upload.ExpiresAt = time.Now().Add(UploadExpiry())
+	err = models.Database.Model(upload).Updates(map[string]interface{}{
+		"upload_offset": upload.Offset,
+		"expires_at":    upload.ExpiresAt,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return upload, copyErr
+}
+
+// OpenCompletedUpload открывает полностью полученную загрузку пользователя для чтения
+func OpenCompletedUpload(id string, userID uint) (*Upload, *os.File, error) {
+	upload, err := GetUpload(id, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !upload.Complete() {
+		return nil, nil, ErrUploadIncomplete
+	}
+
+	file, err := os.Open(upload.path())
+	if err != nil {
+		return nil, nil, err
+	}
+	return upload, file, nil
+}
+
+// DeleteUpload удаляет загрузку пользователя вместе с полученными данными
+func DeleteUpload(id string, userID uint) error {
+	var upload Upload
+	if err := models.Database.Where("id = ? AND user_id = ?", id, userID).First(&upload).Error; err != nil {
+		return err
+	}
+
+	unlock, ok := lockUpload(id)
+	if !ok {
+		return ErrUploadLocked
+	}
+	defer unlock()
+	return removeUpload(&upload)
+}
+
+// RemoveUpload удаляет загрузку, которая уже использована
+func RemoveUpload(upload *Upload) {
+	if upload == nil {
+		return
+	}
+	if err := removeUpload(upload); err != nil {
+		log.Printf("Failed to remove upload %s: %v", upload.ID, err)
+	}
+}
+
+func removeUpload(upload *Upload) error {
+	if err := models.Database.Delete(upload).Error; err != nil {
+		return err
+	}
+	uploadLocks.Delete(upload.ID)
+	if err := os.Remove(upload.path()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// PurgeExpiredUploads удаляет загрузки, которые не дописывались дольше UploadExpiry,
+// в том числе завершённые, но так и не использованные
+func PurgeExpiredUploads() (int, error) {
+	var uploads []Upload
+	if err := models.Database.Where("expires_at < ?", time.Now()).Find(&uploads).Error; err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, upload := range uploads {
+		unlock, ok := lockUpload(upload.ID)
+		if !ok {
+			continue // Загрузка прямо сейчас дописывается
+		}
+		// Пока шла выборка, загрузку могли продлить
+		result := models.Database.Where("id = ? AND expires_at < ?", upload.ID, time.Now()).Delete(&Upload{})
+		if result.Error == nil && result.RowsAffected > 0 {
+			purged++
+			if err := os.Remove(upload.path()); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("Failed to remove upload file %s: %v", upload.ID, err)
+			}
+		}
+		uploadLocks.Delete(upload.ID)
+		unlock()
+		if result.Error != nil {
+			return purged, fmt.Errorf("failed to purge upload %s: %w", upload.ID, result.Error)
+		}
+	}
+	return purged, nil
+}
+
+// StartUploadPurger периодически удаляет просроченные загрузки в фоне.
+// Интервал задаётся переменной окружения UPLOAD_PURGE_INTERVAL.
+func StartUploadPurger() {
+	interval := utils.GetDurationEnv("UPLOAD_PURGE_INTERVAL", DefaultUploadPurgeInterval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			purged, err := PurgeExpiredUploads()
+			if err != nil {
+				log.Printf("Upload purge failed: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired uploads", purged)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,255 @@
+package structur
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"main/src/imaging"
+	"main/src/storage"
+	"main/src/utils"
+	"strconv"
+)
+
+const (
+	// Телефоны не декодируют изображения выше 8-16 тысяч пикселей,
+	// а длинные полосы ещё и долго грузятся целиком
+	DefaultWebtoonSliceHeight = 3000
+	// По умолчанию короткие фрагменты не склеиваются
+	DefaultWebtoonStitchHeight = 0
+)
+
+// WebtoonSliceHeight - высота, выше которой страницы вебтунов режутся на части,
+// переменная окружения WEBTOON_SLICE_HEIGHT. 0 отключает нарезку.
+func WebtoonSliceHeight() int {
+	return intEnv("WEBTOON_SLICE_HEIGHT", DefaultWebtoonSliceHeight)
+}
+
+// WebtoonStitchHeight - страницы вебтунов ниже этой высоты склеиваются с соседними
+// той же ширины, пока результат не выше WebtoonSliceHeight, а хвосты нарезки ниже неё приклеиваются
+// к следующей странице. Переменная окружения WEBTOON_STITCH_HEIGHT.
+func WebtoonStitchHeight() int {
+	return intEnv("WEBTOON_STITCH_HEIGHT", DefaultWebtoonStitchHeight)
+}
+
+func intEnv(key string, fallback int) int {
+	value, err := strconv.Atoi(utils.GetEnv(key, ""))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+// Формат, в котором сохраняются нарезанные и склеенные страницы, по формату загруженного файла
+var segmentFormats = map[string]imaging.Format{
+	"jpeg": imaging.JPEG,
+	"png":  imaging.PNG,
+	"gif":  imaging.PNG,
+	"webp": imaging.WebP,
+}
+
+// uploadedPage - проверенная загруженная страница. У нарезанных и склеенных частей data пустой:
+// они кодируются заново в формате по info.Format.
+type uploadedPage struct {
+	data []byte
+	info imaging.Info
+	img  image.Image
+}
+
+// preparedPage - страница, готовая к записи в хранилище
+type preparedPage struct {
+	data   []byte
+	ext    string
+	width  int
+	height int
+	hash   uint64
+}
+
+// pageWriter готовит страницы главы по порядку чтения. Для вебтунов высокие страницы режутся
+// на части, а короткие фрагменты при включённой склейке накапливаются и сохраняются одной страницей.
+// Короткий хвост нарезки приклеивается к началу следующей страницы. Порядок страниц при этом не меняется.
+// Всё кодирование выполняется здесь, до записи в хранилище и базу.
+type pageWriter struct {
+	webtoon      bool
+	sliceHeight  int
+	stitchHeight int
+
+	pages   []preparedPage
+	pending []uploadedPage // Фрагменты, ожидающие склейки
+	tail    *uploadedPage  // Короткий хвост последней нарезанной страницы
+}
+
+func newPageWriter(comic *Comics, capacity int) *pageWriter {
+	writer := &pageWriter{
+		webtoon: comic.Type == Manhva,
+		pages:   make([]preparedPage, 0, capacity),
+	}
+	if writer.webtoon {
+		writer.sliceHeight = WebtoonSliceHeight()
+		writer.stitchHeight = WebtoonStitchHeight()
+	}
+	return writer
+}
+
+// add принимает следующую по порядку страницу
+func (w *pageWriter) add(page uploadedPage) error {
+	if w.tail != nil {
+		tail := *w.tail
+		w.tail = nil
+		if tail.info.Width == page.info.Width {
+			page = mergePages(tail, page)
+		} else if err := w.store(tail); err != nil {
+			return err
+		}
+	}
+
+	if w.stitchable(page) {
+		w.pending = append(w.pending, page)
+		return nil
+	}
+	if err := w.flush(); err != nil {
+		return err
+	}
+	if w.stitchable(page) {
+		w.pending = append(w.pending, page)
+		return nil
+	}
+
+	if w.webtoon && w.sliceHeight > 0 && page.info.Height > w.sliceHeight {
+		cuts := imaging.FindCuts(page.img, w.sliceHeight)
+		segments := imaging.Slice(page.img, cuts)
+		last := segments[len(segments)-1]
+		if w.stitchHeight > 0 && last.Bounds().Dy() < w.stitchHeight {
+			// Хвост дожидается следующей страницы, чтобы не остаться отдельной узкой полосой
+			w.tail = &uploadedPage{img: last, info: segmentInfo(last, page.info.Format)}
+			segments = segments[:len(segments)-1]
+		}
+		for _, segment := range segments {
+			if err := w.encode(segment, segmentFormats[page.info.Format]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return w.store(page)
+}
+
+// mergePages приклеивает хвост нарезки к началу следующей страницы той же ширины
+func mergePages(tail, page uploadedPage) uploadedPage {
+	img := imaging.Stitch([]image.Image{tail.img, page.img})
+	format := page.info.Format
+	// Если части в разных форматах, склейка сохраняется без потерь
+	if segmentFormats[tail.info.Format] != segmentFormats[format] {
+		format = "png"
+	}
+	return uploadedPage{img: img, info: segmentInfo(img, format)}
+}
+
+// segmentInfo описывает нарезанную или склеенную часть в формате исходной страницы
+func segmentInfo(img image.Image, format string) imaging.Info {
+	bounds := img.Bounds()
+	return imaging.Info{Format: format, Width: bounds.Dx(), Height: bounds.Dy()}
+}
+
+// stitchable сообщает, можно ли добавить страницу к накопленным фрагментам
+func (w *pageWriter) stitchable(page uploadedPage) bool {
+	if !w.webtoon || w.stitchHeight == 0 || page.info.Height >= w.stitchHeight {
+		return false
+	}
+	if len(w.pending) == 0 {
+		return true
+	}
+
+	height := page.info.Height
+	for _, fragment := range w.pending {
+		height += fragment.info.Height
+	}
+	return page.info.Width == w.pending[0].info.Width && (w.sliceHeight == 0 || height <= w.sliceHeight)
+}
+
+// flush сохраняет накопленные фрагменты и хвост нарезки. Одиночный фрагмент сохраняется как был загружен.
+func (w *pageWriter) flush() error {
+	pending := w.pending
+	w.pending = nil
+	if w.tail != nil {
+		pending = append(pending, *w.tail)
+		w.tail = nil
+	}
+
+	switch len(pending) {
+	case 0:
+		return nil
+	case 1:
+		return w.store(pending[0])
+	}
+
+	images := make([]image.Image, 0, len(pending))
+	format := segmentFormats[pending[0].info.Format]
+	for _, fragment := range pending {
+		images = append(images, fragment.img)
+		// Если фрагменты в разных форматах, склейка сохраняется без потерь
+		if segmentFormats[fragment.info.Format] != format {
+			format = imaging.PNG
+		}
+	}
+	return w.encode(imaging.Stitch(images), format)
+}
+
+// store сохраняет страницу как была загружена, а нарезанную или склеенную часть кодирует
+func (w *pageWriter) store(page uploadedPage) error {
+	if page.data == nil {
+		return w.encode(page.img, segmentFormats[page.info.Format])
+	}
+	w.prepare(page.data, pageExtensions[page.info.ContentType], page.info.Width, page.info.Height, page.img)
+	return nil
+}
+
+// encode кодирует нарезанную или склеенную страницу
+func (w *pageWriter) encode(img image.Image, format imaging.Format) error {
+	var encoded bytes.Buffer
+	if err := imaging.Encode(&encoded, img, format); err != nil {
+		return err
+	}
+	bounds := img.Bounds()
+	w.prepare(encoded.Bytes(), imaging.Extension(format), bounds.Dx(), bounds.Dy(), img)
+	return nil
+}
+
+func (w *pageWriter) prepare(data []byte, ext string, width, height int, img image.Image) {
+	w.pages = append(w.pages, preparedPage{
+		data:   data,
+		ext:    ext,
+		width:  width,
+		height: height,
+		hash:   imaging.DHash(img),
+	})
+}
+
+// save записывает подготовленные страницы в хранилище под prefix и возвращает их записи для базы
+func (w *pageWriter) save(prefix string, chapterID uint) ([]Page, error) {
+	pages := make([]Page, 0, len(w.pages))
+	for i, prepared := range w.pages {
+		order := i + 1
+		key, err := saveImage(bytes.NewReader(prepared.data), storage.Key(prefix, fmt.Sprintf("%03d%s", order, prepared.ext)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to save page %d: %w", order, err)
+		}
+		pages = append(pages, Page{
+			ChapterID: chapterID,
+			Order:     order,
+			Width:     prepared.width,
+			Height:    prepared.height,
+			FilePath:  key,
+			Hash:      hashValue(prepared.hash),
+		})
+	}
+	return pages, nil
+}
+
+// hashes - хэши подготовленных страниц для поиска дубликатов
+func (w *pageWriter) hashes() []uint64 {
+	hashes := make([]uint64, 0, len(w.pages))
+	for _, page := range w.pages {
+		hashes = append(hashes, page.hash)
+	}
+	return hashes
+}
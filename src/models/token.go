@@ -0,0 +1,292 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"main/src/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultAccessTokenTTL     = 15 * time.Minute
+	DefaultRefreshTokenTTL    = 30 * 24 * time.Hour
+	DefaultSessionMaxLifetime = 90 * 24 * time.Hour
+	DefaultTokenPurgeInterval = 24 * time.Hour
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used, all tokens of this login are revoked")
+	ErrTokenRevoked        = errors.New("token has been revoked")
+	ErrSessionExpired      = errors.New("session has reached its maximum lifetime, please log in again")
+)
+
+// TokenFamily - один вход пользователя (сессия). Все refresh токены, полученные ротацией
+// от токена, выданного при входе, относятся к одному семейству; access токены
+// ссылаются на него через sid. Отзыв семейства завершает вход целиком.
+type TokenFamily struct {
+	ID         string     `json:"id" gorm:"primaryKey;size:32"`
+	UserID     uint       `json:"user_id" gorm:"index"`
+	Device     string     `json:"device"` // Браузер и система, определённые по User-Agent
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	Current    bool       `json:"current" gorm:"-"` // Сессия, из которой сделан запрос
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// RefreshToken - одноразовый refresh токен. В базе хранится только хэш токена.
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey"`
+	FamilyID  string     `gorm:"size:32;index"`
+	TokenHash string     `gorm:"size:64;uniqueIndex"`
+	ExpiresAt time.Time  `gorm:"index"`
+	UsedAt    *time.Time // Когда токен обменян на новый; повторное предъявление - признак кражи
+	CreatedAt time.Time
+}
+
+// AccessTokenTTL - срок действия access токена, переменная окружения ACCESS_TOKEN_TTL
+func AccessTokenTTL() time.Duration {
+	return utils.GetDurationEnv("ACCESS_TOKEN_TTL", DefaultAccessTokenTTL)
+}
+
+// RefreshTokenTTL - срок действия refresh токена, переменная окружения REFRESH_TOKEN_TTL.
+// Каждая ротация выдаёт токен с новым сроком, но не дольше SessionMaxLifetime от начала входа.
+func RefreshTokenTTL() time.Duration {
+	return utils.GetDurationEnv("REFRESH_TOKEN_TTL", DefaultRefreshTokenTTL)
+}
+
+// SessionMaxLifetime - наибольший срок одного входа, переменная окружения REFRESH_TOKEN_MAX_LIFETIME.
+// Ротация продлевает refresh токен, но не дальше создания семейства плюс этот срок.
+func SessionMaxLifetime() time.Duration {
+	return utils.GetDurationEnv("REFRESH_TOKEN_MAX_LIFETIME", DefaultSessionMaxLifetime)
+}
+
+// refreshExpiry - срок нового refresh токена семейства, созданного в familyCreated
+func refreshExpiry(familyCreated, now time.Time) time.Time {
+	expires := now.Add(RefreshTokenTTL())
+	if limit := familyCreated.Add(SessionMaxLifetime()); expires.After(limit) {
+		return limit
+	}
+	return expires
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRefreshToken сохраняет новый refresh токен семейства и возвращает его открытое значение
+func newRefreshToken(tx *gorm.DB, family TokenFamily) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	err = tx.Create(&RefreshToken{
+		FamilyID:  family.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: refreshExpiry(family.CreatedAt, time.Now()),
+	}).Error
+	return token, err
+}
+
+// authResponse выдаёт access токен и отдаёт его вместе с refresh токеном
+func authResponse(user *User, familyID, refreshToken string) (*AuthResponse, error) {
+	token, err := GenerateJWT(user.ID, user.Role, familyID)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthResponse{
+		User:         user.Response(),
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+// IssueTokens начинает новый вход пользователя с устройства client: создаёт семейство токенов,
+// первый refresh токен и access токен
+func IssueTokens(user *User, client SessionClient) (*AuthResponse, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	family := TokenFamily{
+		ID:         hex.EncodeToString(id),
+		UserID:     user.ID,
+		Device:     describeDevice(client.UserAgent),
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+		LastSeenAt: time.Now(),
+		CreatedAt:  time.Now(),
+	}
+
+	var refreshToken string
+	err := Database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&family).Error; err != nil {
+			return err
+		}
+		var err error
+		refreshToken, err = newRefreshToken(tx, family)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return authResponse(user, family.ID, refreshToken)
+}
+
+// RefreshTokens обменивает refresh токен на новую пару токенов. Старый токен
+// становится недействительным. Если предъявлен уже использованный токен,
+// его копия у кого-то ещё, поэтому отзывается всё семейство.
+func RefreshTokens(refreshToken string, client SessionClient) (*AuthResponse, error) {
+	var stored RefreshToken
+	err := Database.Where("token_hash = ?", hashToken(refreshToken)).First(&stored).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRefreshTokenInvalid
+	} else if err != nil {
+		return nil, err
+	}
+
+	var family TokenFamily
+	if err := Database.Where("id = ?", stored.FamilyID).First(&family).Error; err != nil {
+		return nil, err
+	}
+	if family.RevokedAt != nil {
+		return nil, ErrTokenRevoked
+	}
+	if stored.UsedAt != nil {
+		return nil, reuseDetected(family)
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, ErrRefreshTokenInvalid
+	}
+	// Семейства, созданные до ограничения срока, тоже не живут дольше него
+	if time.Now().After(family.CreatedAt.Add(SessionMaxLifetime())) {
+		return nil, ErrSessionExpired
+	}
+
+	// Роль в новом токене берётся из базы
+	user, err := FetchUser(family.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	var next string
+	err = Database.Transaction(func(tx *gorm.DB) error {
+		// Условие на used_at не даёт двум параллельным запросам обменять один токен дважды
+		result := tx.Model(&RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", stored.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+		err := tx.Model(&family).Updates(map[string]interface{}{
+			"ip":           client.IP,
+			"last_seen_at": time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		next, err = newRefreshToken(tx, family)
+		return err
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		return nil, reuseDetected(family)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return authResponse(user, family.ID, next)
+}
+
+// reuseDetected отзывает семейство, токен которого предъявлен повторно
+func reuseDetected(family TokenFamily) error {
+	log.Printf("Refresh token reuse detected for user %d, revoking token family %s", family.UserID, family.ID)
+	if err := RevokeTokenFamily(family.ID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// RevokeTokenFamily отзывает семейство токенов: его refresh токены больше не обмениваются,
+// а access токены отклоняются AuthMiddleware
+func RevokeTokenFamily(familyID string) error {
+	return Database.Model(&TokenFamily{}).
+		Where("id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// AuthenticateToken проверяет подпись и срок access токена и то, что его вход не завершён.
+// Role в возвращаемых claims - текущая роль пользователя из базы.
+func AuthenticateToken(tokenString string) (*Claims, error) {
+	claims, err := DecodeToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	role, err := touchSession(claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	// Роль в токене только для клиента: права проверяются по роли из базы
+	claims.Role = role
+	return claims, nil
+}
+
+// PurgeExpiredTokens удаляет просроченные refresh токены и семейства, у которых их не осталось,
+// а также просроченные токены из писем.
+// Отозванные семейства хранятся, пока не истекут их токены: по ним распознаётся повторное предъявление.
+func PurgeExpiredTokens() (int64, error) {
+	result := Database.Where("expires_at < ?", time.Now()).Delete(&RefreshToken{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	err := Database.
+		Where("NOT EXISTS (SELECT 1 FROM refresh_tokens WHERE refresh_tokens.family_id = token_families.id)").
+		Delete(&TokenFamily{}).Error
+	if err != nil {
+		return result.RowsAffected, err
+	}
+	// Одноразовые токены из писем после срока не нужны
+	err = Database.Where("expires_at < ?", time.Now()).Delete(&AccountToken{}).Error
+	return result.RowsAffected, err
+}
+
+// StartTokenPurger периодически удаляет просроченные refresh токены в фоне.
+// Интервал задаётся переменной окружения TOKEN_PURGE_INTERVAL.
+func StartTokenPurger() {
+	interval := utils.GetDurationEnv("TOKEN_PURGE_INTERVAL", DefaultTokenPurgeInterval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			purged, err := PurgeExpiredTokens()
+			if err != nil {
+				log.Printf("Token purge failed: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired refresh tokens", purged)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,194 @@
+package models
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRefreshExpiry(t *testing.T) {
+	t.Setenv("REFRESH_TOKEN_TTL", "720h")
+	t.Setenv("REFRESH_TOKEN_MAX_LIFETIME", "2160h")
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		created time.Time
+		want    time.Time
+	}{
+		{name: "new login", created: now, want: now.Add(720 * time.Hour)},
+		{name: "halfway through", created: now.Add(-1000 * time.Hour), want: now.Add(720 * time.Hour)},
+		{name: "close to the maximum", created: now.Add(-2000 * time.Hour), want: now.Add(160 * time.Hour)},
+		{name: "past the maximum", created: now.Add(-3000 * time.Hour), want: now.Add(-840 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := refreshExpiry(tt.created, now); !got.Equal(tt.want) {
+				t.Errorf("refreshExpiry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{a: "token", b: "token", same: true},
+		{a: "token", b: "Token"},
+		{a: "token", b: "token "},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%q vs %q", tt.a, tt.b), func(t *testing.T) {
+			a, b := hashToken(tt.a), hashToken(tt.b)
+			if _, err := hex.DecodeString(a); err != nil || len(a) != 64 {
+				t.Errorf("hashToken(%q) = %q, want 64 hex characters", tt.a, a)
+			}
+			if (a == b) != tt.same {
+				t.Errorf("hashToken(%q) == hashToken(%q) is %v, want %v", tt.a, tt.b, a == b, tt.same)
+			}
+		})
+	}
+}
+
+func TestRandomToken(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		token, err := randomToken(32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(token) != 43 {
+			t.Fatalf("randomToken(32) has %d characters, want 43", len(token))
+		}
+		if seen[token] {
+			t.Fatalf("randomToken returned %q twice", token)
+		}
+		seen[token] = true
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	openTestDatabase(t)
+	client := NewSessionClient("test", "127.0.0.1")
+
+	// Каждый шаг предъявляет один из уже выданных refresh токенов: 0 - выданный при входе
+	tests := []struct {
+		name string
+		use  int
+		want error
+	}{
+		{name: "first rotation", use: 0},
+		{name: "second rotation", use: 1},
+		{name: "unknown token", use: -1, want: ErrRefreshTokenInvalid},
+		{name: "reuse of a rotated token", use: 0, want: ErrRefreshTokenReused},
+		{name: "latest token after reuse", use: 2, want: ErrTokenRevoked},
+	}
+
+	user := createTestUser(t)
+	login, err := IssueTokens(user, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := AuthenticateToken(login.Token)
+	if err != nil {
+		t.Fatalf("access token of a new login: %v", err)
+	}
+	issued := []string{login.RefreshToken}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := "unknown"
+			if tt.use >= 0 {
+				token = issued[tt.use]
+			}
+			response, err := RefreshTokens(token, client)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("RefreshTokens() error = %v, want %v", err, tt.want)
+			}
+			if err == nil {
+				issued = append(issued, response.RefreshToken)
+			}
+		})
+	}
+
+	// Повторное предъявление завершает вход целиком, в том числе его access токены
+	if _, err := AuthenticateToken(login.Token); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("access token of session %s after reuse: %v, want %v", claims.SessionID, err, ErrTokenRevoked)
+	}
+}
+
+func TestRefreshMaxLifetime(t *testing.T) {
+	openTestDatabase(t)
+	t.Setenv("REFRESH_TOKEN_MAX_LIFETIME", "2160h")
+	client := NewSessionClient("test", "127.0.0.1")
+
+	tests := []struct {
+		name string
+		age  time.Duration
+		want error
+	}{
+		{name: "young login", age: time.Hour},
+		{name: "login older than the maximum", age: 2161 * time.Hour, want: ErrSessionExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			login, err := IssueTokens(createTestUser(t), client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := DecodeToken(login.Token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = Database.Model(&TokenFamily{}).Where("id = ?", claims.SessionID).
+				Update("created_at", time.Now().Add(-tt.age)).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := RefreshTokens(login.RefreshToken, client); !errors.Is(err, tt.want) {
+				t.Errorf("RefreshTokens() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthResponseHidesSecrets(t *testing.T) {
+	t.Setenv("JWT_PRIVATE_KEY", "")
+	t.Setenv("JWT_SECRET_KEY", "test secret")
+	t.Setenv("JWT_VERIFICATION_KEYS", "")
+	OpenSigningKeys()
+
+	user := &User{
+		ID:               1,
+		Email:            "reader@example.com",
+		Password:         "$2a$14$bcrypthashbcrypthashbcrypthashbcrypthashbcrypthash",
+		Role:             RoleReader,
+		TOTPEnabled:      true,
+		TOTPSecret:       "enc:v1:sealed",
+		LoginChallengeID: "challenge",
+	}
+	response, err := authResponse(user, "session", "refresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{user.Password, user.TOTPSecret, user.LoginChallengeID, `"password"`} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("auth response contains %q: %s", secret, data)
+		}
+	}
+	if !strings.Contains(string(data), user.Email) {
+		t.Errorf("auth response does not contain the user: %s", data)
+	}
+}
@@ -0,0 +1,470 @@
+package models
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"main/src/utils"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+const (
+	// Шаг TOTP по RFC 6238; коды соседних шагов принимаются из-за расхождения часов
+	totpPeriod = 30
+	totpSkew   = 1
+	// Сколько кодов восстановления выдаётся при включении 2FA
+	recoveryCodeCount = 10
+	// Срок, за который нужно ввести код после пароля
+	loginChallengeTTL = 5 * time.Minute
+	// После стольких неверных кодов подряд проверка 2FA блокируется на totpLockDuration
+	totpMaxFailures  = 5
+	totpLockDuration = 15 * time.Minute
+	// Аудитория токена второго шага входа: такой токен не принимается как access токен
+	loginChallengeAudience = "login-challenge"
+	// Префикс зашифрованного секрета в колонке totp_secret
+	sealedSecretPrefix = "enc:v1:"
+)
+
+var (
+	ErrTOTPEnabled          = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnabled       = errors.New("two-factor authentication is not enabled")
+	ErrTOTPNotSetUp         = errors.New("two-factor authentication setup has not been started")
+	ErrTOTPInvalidCode      = errors.New("invalid two-factor code")
+	ErrTOTPLocked           = errors.New("too many invalid two-factor codes, try again later")
+	ErrLoginChallengeFailed = errors.New("invalid or expired login challenge")
+)
+
+// RecoveryCode - одноразовый код для входа без приложения-аутентификатора.
+// Коды случайные и длинные, поэтому хранится их SHA-256, как у refresh токенов.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index"`
+	CodeHash  string `gorm:"size:64;uniqueIndex"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// TOTPSetup - секрет для приложения-аутентификатора: вручную или QR кодом с otpauth URI
+type TOTPSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// LoginChallenge выдаётся вместо AuthResponse пользователям с 2FA: токен обменивается
+// на AuthResponse вместе с кодом в POST /auth/2fa/verify
+type LoginChallenge struct {
+	ChallengeToken string `json:"challenge_token"`
+	ExpiresIn      int64  `json:"expires_in"`
+}
+
+type challengeClaims struct {
+	UserID uint `json:"uid"`
+	jwt.RegisteredClaims
+}
+
+var totpOptions = totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+
+// totpCipher шифрует секреты TOTP в базе, настраивается в OpenTOTPKey
+var totpCipher cipher.AEAD
+
+// OpenTOTPKey читает ключ шифрования секретов TOTP из переменной окружения TOTP_ENCRYPTION_KEY:
+// 32 байта в base64, например из "openssl rand -base64 32". Без ключа сервер не запускается:
+// по утёкшей копии базы нельзя будет получить коды. Секреты, сохранённые без шифрования, шифруются при запуске.
+func OpenTOTPKey() {
+	key, err := base64.StdEncoding.DecodeString(os.Getenv("TOTP_ENCRYPTION_KEY"))
+	if err != nil || len(key) != 32 {
+		panic("TOTP_ENCRYPTION_KEY must be 32 bytes encoded in base64")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	if totpCipher, err = cipher.NewGCM(block); err != nil {
+		panic(err)
+	}
+	if err := sealPlainSecrets(); err != nil {
+		panic(fmt.Errorf("failed to encrypt TOTP secrets: %w", err))
+	}
+}
+
+// sealTOTPSecret шифрует секрет AES-GCM. Зашифрованный секрет привязан к пользователю
+// и не подойдёт, если переставить его в другую строку.
+func sealTOTPSecret(userID uint, secret string) (string, error) {
+	nonce := make([]byte, totpCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := totpCipher.Seal(nonce, nonce, []byte(secret), totpSecretData(userID))
+	return sealedSecretPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// openTOTPSecret расшифровывает секрет из колонки totp_secret
+func openTOTPSecret(userID uint, stored string) (string, error) {
+	encoded, ok := strings.CutPrefix(stored, sealedSecretPrefix)
+	if !ok {
+		return "", errors.New("TOTP secret is not encrypted")
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < totpCipher.NonceSize() {
+		return "", errors.New("malformed TOTP secret")
+	}
+	nonce, ciphertext := sealed[:totpCipher.NonceSize()], sealed[totpCipher.NonceSize():]
+	secret, err := totpCipher.Open(nil, nonce, ciphertext, totpSecretData(userID))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+	}
+	return string(secret), nil
+}
+
+func totpSecretData(userID uint) []byte {
+	return []byte("totp:" + strconv.FormatUint(uint64(userID), 10))
+}
+
+// sealPlainSecrets шифрует секреты, сохранённые до появления шифрования
+func sealPlainSecrets() error {
+	var users []User
+	err := Database.Select("id, totp_secret").
+		Where("totp_secret <> '' AND totp_secret NOT LIKE ?", sealedSecretPrefix+"%").
+		Find(&users).Error
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		sealed, err := sealTOTPSecret(user.ID, user.TOTPSecret)
+		if err != nil {
+			return err
+		}
+		if err := Database.Model(&user).Update("totp_secret", sealed).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TOTPIssuer - название сервиса в приложении-аутентификаторе, переменная окружения TOTP_ISSUER
+func TOTPIssuer() string {
+	return utils.GetEnv("TOTP_ISSUER", "WaManga")
+}
+
+// SetupTOTP создаёт новый секрет. 2FA включается только после подтверждения кодом в EnableTOTP,
+// поэтому незавершённая настройка не мешает входу.
+func SetupTOTP(user *User) (*TOTPSetup, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTOTPEnabled
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      TOTPIssuer(),
+		AccountName: user.Email,
+		Period:      totpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := sealTOTPSecret(user.ID, key.Secret())
+	if err != nil {
+		return nil, err
+	}
+	err = Database.Model(user).Updates(map[string]interface{}{"totp_secret": sealed, "totp_last_step": 0}).Error
+	if err != nil {
+		return nil, err
+	}
+	return &TOTPSetup{Secret: key.Secret(), URI: key.URL()}, nil
+}
+
+// EnableTOTP включает 2FA, если код из приложения совпал с секретом из SetupTOTP,
+// и завершает остальные сессии пользователя, кроме текущей sessionID: входы без второго фактора
+// могли быть чужими. Возвращает коды восстановления: они показываются один раз.
+func EnableTOTP(user *User, code, sessionID string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTOTPEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTOTPNotSetUp
+	}
+	if err := checkTOTP(user, code, false); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := Database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("totp_enabled", true).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&TokenFamily{}).
+			Where("user_id = ? AND id <> ? AND revoked_at IS NULL", user.ID, sessionID).
+			Update("revoked_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	return codes, err
+}
+
+// DisableTOTP выключает 2FA. Нужен действующий код или код восстановления.
+func DisableTOTP(user *User, code string) error {
+	if !user.TOTPEnabled {
+		return ErrTOTPNotEnabled
+	}
+	if err := checkTOTP(user, code, true); err != nil {
+		return err
+	}
+
+	return Database.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(user).Updates(map[string]interface{}{
+			"totp_enabled":   false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&RecoveryCode{}).Error
+	})
+}
+
+// RegenerateRecoveryCodes выдаёт новые коды восстановления взамен прежних. Нужен действующий код.
+func RegenerateRecoveryCodes(user *User, code string) ([]string, error) {
+	if !user.TOTPEnabled {
+		return nil, ErrTOTPNotEnabled
+	}
+	if err := checkTOTP(user, code, false); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := Database.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	return codes, err
+}
+
+// StartLoginChallenge выдаёт токен второго шага входа после верного пароля.
+// Действует только последний выданный токен, и обменять его на токены можно один раз.
+func StartLoginChallenge(user *User) (*LoginChallenge, error) {
+	id, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	if err := Database.Model(user).Update("login_challenge_id", id).Error; err != nil {
+		return nil, err
+	}
+
+	claims := &challengeClaims{
+		UserID: user.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			Audience:  jwt.ClaimStrings{loginChallengeAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(loginChallengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	token := jwt.NewWithClaims(currentKey.method, claims)
+	token.Header["kid"] = currentKey.id
+	tokenString, err := token.SignedString(currentKey.sign)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginChallenge{ChallengeToken: tokenString, ExpiresIn: int64(loginChallengeTTL.Seconds())}, nil
+}
+
+// CompleteLoginChallenge проверяет код из приложения или код восстановления и завершает вход
+func CompleteLoginChallenge(challengeToken, code string, client SessionClient) (*AuthResponse, error) {
+	claims := &challengeClaims{}
+	token, err := jwt.ParseWithClaims(challengeToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := verificationKeys[kid]
+		if !ok || token.Method.Alg() != key.method.Alg() {
+			return nil, ErrLoginChallengeFailed
+		}
+		return key.verify, nil
+	})
+	if err != nil || !token.Valid || !claims.VerifyAudience(loginChallengeAudience, true) || claims.ID == "" {
+		return nil, ErrLoginChallengeFailed
+	}
+
+	user, err := FetchUser(claims.UserID)
+	if err != nil {
+		return nil, ErrLoginChallengeFailed
+	}
+	if !user.TOTPEnabled || subtle.ConstantTimeCompare([]byte(user.LoginChallengeID), []byte(claims.ID)) != 1 {
+		return nil, ErrLoginChallengeFailed
+	}
+
+	// Токен погашается условным обновлением до проверки кода: из двух одновременных запросов
+	// код проверяет только один, и второй не расходует одноразовый код восстановления
+	result := Database.Model(&User{}).
+		Where("id = ? AND login_challenge_id = ?", user.ID, claims.ID).
+		Update("login_challenge_id", "")
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrLoginChallengeFailed
+	}
+
+	if err := checkTOTP(user, code, true); err != nil {
+		if errors.Is(err, ErrTOTPInvalidCode) {
+			restoreLoginChallenge(user.ID, claims.ID)
+		}
+		return nil, err
+	}
+	return IssueTokens(user, client)
+}
+
+// restoreLoginChallenge возвращает токен второго шага после неверного кода, чтобы опечатка
+// не заставляла вводить пароль заново. Токен не возвращается, если за это время выдан новый
+// или неверный код заблокировал проверку.
+func restoreLoginChallenge(userID uint, challengeID string) {
+	err := Database.Model(&User{}).
+		Where("id = ? AND login_challenge_id = '' AND (totp_locked_until IS NULL OR totp_locked_until <= ?)", userID, time.Now()).
+		Update("login_challenge_id", challengeID).Error
+	if err != nil {
+		log.Printf("Failed to restore login challenge for user %d: %v", userID, err)
+	}
+}
+
+// checkTOTP проверяет код из приложения, а если allowRecovery - и код восстановления.
+// Каждый код принимается один раз. Неверные коды подряд временно блокируют проверку.
+func checkTOTP(user *User, code string, allowRecovery bool) error {
+	attempts, err := reserveTOTPAttempt(user.ID)
+	if err != nil {
+		return err
+	}
+
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	ok, err := useTOTPCode(user, code)
+	if err == nil && !ok && allowRecovery && len(code) != int(otp.DigitsSix) {
+		ok, err = useRecoveryCode(user.ID, code)
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return totpFailed(user, attempts)
+	}
+	return Database.Model(user).Updates(map[string]interface{}{"totp_failed_attempts": 0, "totp_locked_until": nil}).Error
+}
+
+// reserveTOTPAttempt засчитывает попытку до проверки кода и возвращает номер попытки.
+// Счётчик увеличивается в базе одним запросом, поэтому одновременные запросы не могут
+// проверить больше totpMaxFailures кодов за время блокировки.
+func reserveTOTPAttempt(userID uint) (int, error) {
+	var attempts int
+	result := Database.Raw(`UPDATE users SET totp_failed_attempts = totp_failed_attempts + 1
+		WHERE id = ? AND (totp_locked_until IS NULL OR totp_locked_until <= ?)
+		RETURNING totp_failed_attempts`, userID, time.Now()).Scan(&attempts)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 || attempts > totpMaxFailures {
+		return 0, ErrTOTPLocked
+	}
+	return attempts, nil
+}
+
+// useTOTPCode ищет шаг времени, которому соответствует код, и запоминает его:
+// повторить перехваченный код в пределах его 30 секунд нельзя
+func useTOTPCode(user *User, code string) (bool, error) {
+	if len(code) != int(otp.DigitsSix) {
+		return false, nil
+	}
+
+	secret, err := openTOTPSecret(user.ID, user.TOTPSecret)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	for offset := -totpSkew; offset <= totpSkew; offset++ {
+		at := now.Add(time.Duration(offset*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(secret, at, totpOptions)
+		if err != nil {
+			return false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) != 1 {
+			continue
+		}
+
+		step := at.Unix() / totpPeriod
+		result := Database.Model(&User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		return result.RowsAffected > 0, nil
+	}
+	return false, nil
+}
+
+func useRecoveryCode(userID uint, code string) (bool, error) {
+	result := Database.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// totpFailed отвечает на неверный код. Последняя из totpMaxFailures попыток блокирует проверку
+// на totpLockDuration и отменяет токен второго шага входа.
+func totpFailed(user *User, attempts int) error {
+	if attempts >= totpMaxFailures {
+		err := Database.Model(user).Updates(map[string]interface{}{
+			"totp_failed_attempts": 0,
+			"totp_locked_until":    time.Now().Add(totpLockDuration),
+			"login_challenge_id":   "",
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return ErrTOTPInvalidCode
+}
+
+// normalizeRecoveryCode позволяет вводить код без дефисов и в любом регистре
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(code, "-", ""))
+}
+
+// replaceRecoveryCodes удаляет прежние коды восстановления и создаёт новые вида "abcd-efgh-ijkl"
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	records := make([]RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 8)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf))[:12]
+		codes[i] = fmt.Sprintf("%s-%s-%s", raw[:4], raw[4:8], raw[8:])
+		records[i] = RecoveryCode{UserID: userID, CodeHash: hashToken(normalizeRecoveryCode(codes[i]))}
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
@@ -0,0 +1,301 @@
+package models
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+// setTestTOTPKey настраивает шифрование секретов TOTP случайным ключом без обращения к базе
+func setTestTOTPKey(t *testing.T) {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := totpCipher
+	if totpCipher, err = cipher.NewGCM(block); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { totpCipher = previous })
+}
+
+func TestSealTOTPSecret(t *testing.T) {
+	setTestTOTPKey(t)
+	const secret = "JBSWY3DPEHPK3PXP"
+	sealed, err := sealTOTPSecret(7, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, secret) || !strings.HasPrefix(sealed, sealedSecretPrefix) {
+		t.Fatalf("sealTOTPSecret() = %q, want an encrypted value", sealed)
+	}
+	other, _ := sealTOTPSecret(7, secret)
+	if other == sealed {
+		t.Error("two seals of the same secret are equal, the nonce is not random")
+	}
+
+	encoded := strings.TrimPrefix(sealed, sealedSecretPrefix)
+	raw, _ := base64.RawStdEncoding.DecodeString(encoded)
+	raw[len(raw)-1] ^= 1
+	tampered := sealedSecretPrefix + base64.RawStdEncoding.EncodeToString(raw)
+
+	tests := []struct {
+		name    string
+		userID  uint
+		stored  string
+		wantErr bool
+	}{
+		{name: "owner", userID: 7, stored: sealed},
+		{name: "moved to another user", userID: 8, stored: sealed, wantErr: true},
+		{name: "tampered", userID: 7, stored: tampered, wantErr: true},
+		{name: "plain secret", userID: 7, stored: secret, wantErr: true},
+		{name: "truncated", userID: 7, stored: sealedSecretPrefix + "AAAA", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := openTOTPSecret(tt.userID, tt.stored)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("openTOTPSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != secret {
+				t.Errorf("openTOTPSecret() = %q, want %q", got, secret)
+			}
+		})
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{code: "abcd-efgh-ijkl", want: "abcdefghijkl"},
+		{code: "ABCD-EFGH-IJKL", want: "abcdefghijkl"},
+		{code: "abcdefghijkl", want: "abcdefghijkl"},
+		{code: "ab-cd-ef-gh-ij-kl", want: "abcdefghijkl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			if got := normalizeRecoveryCode(tt.code); got != tt.want {
+				t.Errorf("normalizeRecoveryCode(%q) = %q, want %q", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+// enableTestTOTP создаёт пользователя с включённой 2FA и возвращает его секрет и коды восстановления
+func enableTestTOTP(t *testing.T) (*User, string, []string) {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TOTP_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(key))
+	OpenTOTPKey()
+
+	user := createTestUser(t)
+	setup, err := SetupTOTP(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, err = FetchUser(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if user.TOTPSecret == setup.Secret {
+		t.Fatal("TOTP secret is stored in plain text")
+	}
+
+	// Код предыдущего шага, чтобы коды текущего и следующего шага остались для проверок
+	code, err := totp.GenerateCodeCustom(setup.Secret, time.Now().Add(-totpPeriod*time.Second), totpOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := EnableTOTP(user, code, "")
+	if err != nil {
+		t.Fatalf("EnableTOTP(): %v", err)
+	}
+	if user, err = FetchUser(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	return user, setup.Secret, codes
+}
+
+func TestCheckTOTPSteps(t *testing.T) {
+	openTestDatabase(t)
+	user, secret, _ := enableTestTOTP(t)
+	now := time.Now()
+	codeAt := func(offset int) string {
+		code, err := totp.GenerateCodeCustom(secret, now.Add(time.Duration(offset*totpPeriod)*time.Second), totpOptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	// Шаги выполняются по порядку: принятый код запоминает свой шаг времени
+	tests := []struct {
+		name string
+		code string
+		want error
+	}{
+		{name: "step used to enable", code: codeAt(-1), want: ErrTOTPInvalidCode},
+		{name: "current step", code: codeAt(0)},
+		{name: "replay of the current step", code: codeAt(0), want: ErrTOTPInvalidCode},
+		{name: "next step within skew", code: codeAt(1)},
+		{name: "two steps ahead", code: codeAt(2), want: ErrTOTPInvalidCode},
+		{name: "wrong length", code: "12345", want: ErrTOTPInvalidCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkTOTP(user, tt.code, false); !errors.Is(err, tt.want) {
+				t.Errorf("checkTOTP(%q) error = %v, want %v", tt.code, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	openTestDatabase(t)
+	user, _, codes := enableTestTOTP(t)
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("EnableTOTP() returned %d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+	for _, code := range codes {
+		if len(code) != 14 || strings.Count(code, "-") != 2 {
+			t.Errorf("recovery code %q is not in the abcd-efgh-ijkl form", code)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		code          string
+		allowRecovery bool
+		want          error
+	}{
+		{name: "not allowed for this action", code: codes[0], want: ErrTOTPInvalidCode},
+		{name: "as issued", code: codes[0], allowRecovery: true},
+		{name: "used twice", code: codes[0], allowRecovery: true, want: ErrTOTPInvalidCode},
+		{name: "upper case without dashes", code: strings.ToUpper(strings.ReplaceAll(codes[1], "-", "")), allowRecovery: true},
+		{name: "unknown", code: "aaaa-bbbb-cccc", allowRecovery: true, want: ErrTOTPInvalidCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkTOTP(user, tt.code, tt.allowRecovery); !errors.Is(err, tt.want) {
+				t.Errorf("checkTOTP(%q) error = %v, want %v", tt.code, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTOTPLock(t *testing.T) {
+	openTestDatabase(t)
+	user, secret, _ := enableTestTOTP(t)
+
+	for attempt := 1; attempt <= totpMaxFailures; attempt++ {
+		if err := checkTOTP(user, "000000", false); !errors.Is(err, ErrTOTPInvalidCode) {
+			t.Fatalf("attempt %d: %v, want %v", attempt, err, ErrTOTPInvalidCode)
+		}
+	}
+
+	// После блокировки не проверяется даже верный код
+	code, err := totp.GenerateCodeCustom(secret, time.Now(), totpOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkTOTP(user, code, false); !errors.Is(err, ErrTOTPLocked) {
+		t.Errorf("checkTOTP() after %d failures: %v, want %v", totpMaxFailures, err, ErrTOTPLocked)
+	}
+}
+
+func TestLoginChallengeSingleUse(t *testing.T) {
+	openTestDatabase(t)
+	user, _, codes := enableTestTOTP(t)
+	client := NewSessionClient("test", "127.0.0.1")
+
+	first, err := StartLoginChallenge(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := StartLoginChallenge(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeToken(second.ChallengeToken); err == nil {
+		t.Error("login challenge token is accepted as an access token")
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		code  string
+		want  error
+	}{
+		{name: "superseded challenge", token: first.ChallengeToken, code: codes[0], want: ErrLoginChallengeFailed},
+		{name: "wrong code keeps the challenge", token: second.ChallengeToken, code: "aaaa-bbbb-cccc", want: ErrTOTPInvalidCode},
+		{name: "latest challenge", token: second.ChallengeToken, code: codes[1]},
+		{name: "latest challenge again", token: second.ChallengeToken, code: codes[2], want: ErrLoginChallengeFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := CompleteLoginChallenge(tt.token, tt.code, client); !errors.Is(err, tt.want) {
+				t.Errorf("CompleteLoginChallenge() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginChallengeConcurrent(t *testing.T) {
+	openTestDatabase(t)
+	user, _, codes := enableTestTOTP(t)
+	client := NewSessionClient("test", "127.0.0.1")
+	challenge, err := StartLoginChallenge(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Два запроса с одним токеном и разными кодами восстановления: вход завершает один,
+	// и расходуется только его код
+	var wg sync.WaitGroup
+	results := make([]error, 2)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, results[i] = CompleteLoginChallenge(challenge.ChallengeToken, codes[i], client)
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range results {
+		if err == nil {
+			succeeded++
+		} else if !errors.Is(err, ErrLoginChallengeFailed) {
+			t.Errorf("CompleteLoginChallenge() error = %v, want nil or %v", err, ErrLoginChallengeFailed)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("%d requests completed the challenge, want 1", succeeded)
+	}
+
+	var used int64
+	if err := Database.Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NOT NULL", user.ID).Count(&used).Error; err != nil {
+		t.Fatal(err)
+	}
+	if used != 1 {
+		t.Errorf("%d recovery codes used, want 1", used)
+	}
+}
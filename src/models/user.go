@@ -5,6 +5,7 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 	"regexp"
+	"time"
 )
 
 type User struct {
@@ -12,13 +13,47 @@ type User struct {
 	Email    string `json:"email" gorm:"unique"`
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Role     Role   `json:"role" gorm:"default:reader"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at"` // Когда email подтверждён по ссылке из письма, nil - не подтверждён
+
+	// Двухфакторная аутентификация по TOTP, см. totp.go
+	TOTPEnabled        bool       `json:"totp_enabled" gorm:"not null;default:false"`
+	TOTPSecret         string     `json:"-"`
+	TOTPLastStep       int64      `json:"-" gorm:"not null;default:0"` // Шаг времени последнего принятого кода
+	TOTPFailedAttempts int        `json:"-" gorm:"not null;default:0"`
+	TOTPLockedUntil    *time.Time `json:"-"`
+	LoginChallengeID   string     `json:"-"` // Действующий токен второго шага входа, см. StartLoginChallenge
+}
+
+// UserResponse - данные пользователя для ответа без хэша пароля и секретов 2FA
+type UserResponse struct {
+	ID              uint       `json:"id"`
+	Email           string     `json:"email"`
+	Username        string     `json:"username"`
+	Role            Role       `json:"role"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	TOTPEnabled     bool       `json:"totp_enabled"`
+}
+
+func (user *User) Response() *UserResponse {
+	return &UserResponse{
+		ID:              user.ID,
+		Email:           user.Email,
+		Username:        user.Username,
+		Role:            user.Role,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		TOTPEnabled:     user.TOTPEnabled,
+	}
 }
 
 type AuthResponse struct {
-	ID     uint   `json:"id" gorm:"primaryKey"`          // Добавляем ID для AuthResponse
-	UserID uint   `json:"user_id"`                       // Внешний ключ для пользователя
-	User   *User  `json:"user" gorm:"foreignKey:UserID"` // Связь с моделью User через внешний ключ
-	Token  string `json:"token"`
+	ID           uint          `json:"id" gorm:"primaryKey"` // Добавляем ID для AuthResponse
+	UserID       uint          `json:"user_id"`              // Внешний ключ для пользователя
+	User         *UserResponse `json:"user" gorm:"-"`        // Пользователь без хэша пароля и секретов 2FA
+	Token        string        `json:"token"`
+	RefreshToken string        `json:"refresh_token,omitempty" gorm:"-"` // Одноразовый токен для POST /auth/refresh
+	ExpiresIn    int64         `json:"expires_in,omitempty" gorm:"-"`    // Через сколько секунд истекает token
 }
 
 var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
@@ -51,7 +86,13 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
-func (user *User) Register() (*AuthResponse, error) {
+func (user *User) Register(client SessionClient) (*AuthResponse, error) {
+	// Новые пользователи всегда получают роль читателя, остальные роли назначает администратор
+	user.Role = RoleReader
+	// Подтверждение email и 2FA нельзя передать в теле запроса
+	user.EmailVerifiedAt = nil
+	user.TOTPEnabled = false
+
 	// Проверяем, что email имеет корректный формат
 	if !emailRegex.MatchString(user.Email) {
 		return nil, errors.New("invalid email format")
@@ -89,50 +130,49 @@ func (user *User) Register() (*AuthResponse, error) {
 		return nil, err
 	}
 
-	// Генерируем JWT токен
-	token, err := GenerateJWT(user.ID)
-	if err != nil {
-		return nil, err
-	}
+	// Письмо со ссылкой для подтверждения email
+	sendWelcomeMail(user)
 
-	// Формируем ответ
-	response := AuthResponse{
-		User:  user, // Обратите внимание: вы можете передавать только ID, если хотите повысить безопасность
-		Token: token,
-	}
-
-	return &response, nil
+	// Выдаём access и refresh токены
+	return IssueTokens(user, client)
 }
 
-func (user *User) Login() (*AuthResponse, error) {
+// Login проверяет пароль. Если у пользователя включена 2FA, вместо токенов возвращается
+// LoginChallenge, который обменивается на токены вместе с кодом.
+func (user *User) Login(client SessionClient) (*AuthResponse, *LoginChallenge, error) {
 	var err error
 	userFromDb := FetchUserByEmail(user.Email)
 
 	if userFromDb.Email == "" {
 		err = errors.New("User or password incorrect")
-		return &AuthResponse{}, err
+		return nil, nil, err
 	}
 
 	var isCheckedPassword = CheckPasswordHash(user.Password, userFromDb.Password)
 	if !isCheckedPassword {
 		err = errors.New("User or password incorrect")
-		return &AuthResponse{}, err
+		return nil, nil, err
 	}
 
-	token, err := GenerateJWT(user.ID)
-	if err != nil {
-		return &AuthResponse{}, err
+	// Второй шаг входа: токены выдаются после проверки кода
+	if userFromDb.TOTPEnabled {
+		challenge, err := StartLoginChallenge(&userFromDb)
+		return nil, challenge, err
 	}
 
-	response := AuthResponse{
-		User:  &userFromDb,
-		Token: token,
+	response, err := IssueTokens(&userFromDb, client)
+	if err != nil {
+		return nil, nil, err
 	}
-
-	return &response, nil
+	return response, nil, nil
 }
 
 func (user *User) UpdateUser(id string) (*User, error) {
+	// Роль, подтверждение email и 2FA не меняются через обновление профиля
+	user.Role = ""
+	user.EmailVerifiedAt = nil
+	user.TOTPEnabled = false
+
 	if user.Password != "" {
 		err := user.HashPassword()
 		if err != nil {
@@ -140,7 +180,18 @@ func (user *User) UpdateUser(id string) (*User, error) {
 		}
 	}
 
-	err := Database.Model(&User{}).Where("id = ?", id).Updates(user).Error
+	err := Database.Transaction(func(tx *gorm.DB) error {
+		// Новый адрес нужно подтвердить заново. Тот же адрес в запросе подтверждение не сбрасывает.
+		if user.Email != "" {
+			err := tx.Model(&User{}).
+				Where("id = ? AND email <> ? AND email_verified_at IS NOT NULL", id, user.Email).
+				Update("email_verified_at", nil).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Model(&User{}).Where("id = ?", id).Updates(user).Error
+	})
 	if err != nil {
 		return &User{}, err
 	}
@@ -1,8 +1,12 @@
 package routes
 
 import (
+	"fmt"
 	"main/src/controllers"
 	"main/src/middlewares"
+	"main/src/models"
+	"os"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,19 +18,104 @@ func startupsGroupRouter(baseRouter *gin.RouterGroup) {
 	// Роуты авторизации
 	auth.GET("/profile", middlewares.AuthMiddleware(), controllers.GetProfile)
 	auth.POST("/login", controllers.Login)
+	auth.POST("/refresh", controllers.Refresh)
+	auth.POST("/logout", middlewares.AuthMiddleware(), controllers.Logout)
+	auth.POST("/verify-email", controllers.VerifyEmail)
+	auth.POST("/verify-email/resend", middlewares.AuthMiddleware(), controllers.ResendVerification)
+	auth.POST("/password/forgot", controllers.ForgotPassword)
+	auth.POST("/password/reset", controllers.ResetPassword)
+	auth.POST("/2fa/verify", controllers.VerifyLoginChallenge)
+	auth.POST("/2fa/setup", middlewares.AuthMiddleware(), controllers.SetupTOTP)
+	auth.POST("/2fa/enable", middlewares.AuthMiddleware(), controllers.EnableTOTP)
+	auth.POST("/2fa/disable", middlewares.AuthMiddleware(), controllers.DisableTOTP)
+	auth.POST("/2fa/recovery-codes", middlewares.AuthMiddleware(), controllers.RegenerateRecoveryCodes)
+	auth.GET("/sessions", middlewares.AuthMiddleware(), controllers.GetSessions)
+	auth.DELETE("/sessions/:id", middlewares.AuthMiddleware(), controllers.RevokeSession)
 	auth.POST("/register", controllers.Register) // <---- этот маршрут должен существовать
 }
 
 func zalupaCom(baseRouter *gin.RouterGroup) {
 	auth := baseRouter.Group("/comics")
 
-	auth.GET("/info", controllers.GetComicsInfo)
-	auth.POST("/create", controllers.CreateComics)
+	auth.GET("", middlewares.OptionalAuthMiddleware(), controllers.ListComics)
+	auth.GET("/search", middlewares.OptionalAuthMiddleware(), controllers.SearchComics)
+	auth.GET("/suggest", middlewares.OptionalAuthMiddleware(), controllers.SuggestComics)
+	auth.GET("/info", middlewares.OptionalAuthMiddleware(), controllers.GetComicsInfo)
+	auth.GET("/trash", middlewares.AuthMiddleware(), middlewares.RequirePermission(models.PermComicsDelete), controllers.GetTrash)
+	auth.POST("/create", middlewares.AuthMiddleware(), middlewares.RequirePermission(models.PermComicsCreate), controllers.CreateComics)
+	auth.GET("/:slug", middlewares.OptionalAuthMiddleware(), controllers.GetComics)
+	auth.PATCH("/:slug", middlewares.AuthMiddleware(), middlewares.RequirePermission(models.PermComicsUpdate), controllers.UpdateComics)
+	auth.DELETE("/:slug", middlewares.AuthMiddleware(), middlewares.RequirePermission(models.PermComicsDelete), controllers.DeleteComics)
+	auth.POST("/:slug/restore", middlewares.AuthMiddleware(), middlewares.RequirePermission(models.PermComicsDelete), controllers.RestoreComics)
+	auth.GET("/:slug/revisions", middlewares.AuthMiddleware(), middlewares.RequirePermission(models.PermComicsUpdate), controllers.GetComicRevisions)
+	auth.POST("/:slug/revisions/:id/restore", middlewares.AuthMiddleware(), middlewares.RequirePermission(models.PermRevisionsRestore), controllers.RestoreComicRevision)
+}
+
+// chaptersGroupRouter - настройка маршрутов для глав комикса
+func chaptersGroupRouter(baseRouter *gin.RouterGroup) {
+	chapters := baseRouter.Group("/comics/:slug/chapters")
+
+	chapters.GET("", middlewares.OptionalAuthMiddleware(), controllers.GetChapters)
+	chapters.GET("/:id", middlewares.OptionalAuthMiddleware(), controllers.GetChapter)
+	chapters.GET("/:id/comicinfo", middlewares.OptionalAuthMiddleware(), controllers.GetChapterComicInfo)
+	chapters.GET("/:id/export", middlewares.OptionalAuthMiddleware(), controllers.ExportChapter)
+	chapters.POST("", middlewares.AuthMiddleware(), middlewares.RequirePermission(models.PermChaptersUpload), controllers.CreateChapter)
+	chapters.POST("/import", middlewares.AuthMiddleware(), middlewares.RequirePermission(models.PermChaptersUpload), controllers.ImportChapter)
+	chapters.PUT("/order", middlewares.AuthMiddleware(), middlewares.RequirePermission(models.PermChaptersUpload), controllers.ReorderChapters)
+	chapters.DELETE("/:id", middlewares.AuthMiddleware(), middlewares.RequirePermission(models.PermChaptersDelete), controllers.DeleteChapter)
+}
+
+// imagesGroupRouter - раздача изображений из хранилища
+func imagesGroupRouter(baseRouter *gin.RouterGroup) {
+	images := baseRouter.Group("/images")
+
+	images.GET("/*key", middlewares.OptionalAuthMiddleware(), controllers.ServeImage)
+	images.HEAD("/*key", middlewares.OptionalAuthMiddleware(), controllers.ServeImage)
+}
+
+// uploadsGroupRouter - возобновляемые загрузки больших файлов по протоколу tus
+func uploadsGroupRouter(baseRouter *gin.RouterGroup) {
+	uploads := baseRouter.Group("/uploads")
+
+	uploads.OPTIONS("", controllers.UploadOptions)
+	uploads.OPTIONS("/:id", controllers.UploadOptions)
+	uploads.POST("", middlewares.AuthMiddleware(), middlewares.RequirePermission(models.PermUploadsCreate), controllers.CreateUpload)
+	uploads.HEAD("/:id", middlewares.AuthMiddleware(), middlewares.RequirePermission(models.PermUploadsCreate), controllers.GetUploadOffset)
+	uploads.PATCH("/:id", middlewares.AuthMiddleware(), middlewares.RequirePermission(models.PermUploadsCreate), controllers.WriteUpload)
+	uploads.DELETE("/:id", middlewares.AuthMiddleware(), middlewares.RequirePermission(models.PermUploadsCreate), controllers.DeleteUpload)
+}
+
+// adminGroupRouter - настройка маршрутов администрирования
+func adminGroupRouter(baseRouter *gin.RouterGroup) {
+	admin := baseRouter.Group("/admin", middlewares.AuthMiddleware())
+
+	admin.PUT("/users/:id/role", middlewares.RequirePermission(models.PermUsersManage), controllers.SetUserRole)
+	admin.GET("/audit", middlewares.RequirePermission(models.PermAuditView), controllers.GetAuditLogs)
+	admin.GET("/duplicates", middlewares.RequirePermission(models.PermDuplicatesView), controllers.GetDuplicateComics)
+}
+
+// trustedProxies - адреса или подсети обратных прокси через запятую, переменная окружения TRUSTED_PROXIES.
+// Только от них принимается X-Forwarded-For: иначе любой клиент мог бы подставить свой IP
+// в список сессий и журнал аудита. По умолчанию прокси нет.
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
 }
 
 // SetupRoutes - настройка всех маршрутов
 func SetupRoutes() *gin.Engine {
 	r := gin.Default()
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		panic(fmt.Errorf("invalid TRUSTED_PROXIES: %w", err))
+	}
+
+	// Открытые ключи JWT для других сервисов по общепринятому адресу
+	r.GET("/.well-known/jwks.json", controllers.GetJWKS)
 
 	// Группируем версии API
 	apiV1 := r.Group("/api/v1")
@@ -34,6 +123,10 @@ func SetupRoutes() *gin.Engine {
 	// Добавляем маршруты для авторизации
 	startupsGroupRouter(apiV1)
 	zalupaCom(apiV1)
+	chaptersGroupRouter(apiV1)
+	adminGroupRouter(apiV1)
+	imagesGroupRouter(apiV1)
+	uploadsGroupRouter(apiV1)
 
 	return r
 }
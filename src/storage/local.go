@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Local хранит объекты в директории на локальном диске
+type Local struct {
+	root string
+}
+
+func NewLocal(root string) (*Local, error) {
+	if err := os.MkdirAll(root, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &Local{root: root}, nil
+}
+
+func (l *Local) path(key string) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+// Put записывает объект во временный файл и переименовывает его,
+// чтобы читатели никогда не видели наполовину записанный файл
+func (l *Local) Put(key string, reader io.Reader, size int64, contentType string) error {
+	filePath, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(filePath), tempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := io.Copy(file, reader); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(file.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filePath)
+}
+
+type localObject struct {
+	*os.File
+	key string
+}
+
+func (o *localObject) Stat() (ObjectInfo, error) {
+	info, err := o.File.Stat()
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: o.key, Size: info.Size(), ModTime: info.ModTime(), ContentType: ContentType(o.key)}, nil
+}
+
+func (l *Local) Open(key string) (Object, error) {
+	filePath, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &localObject{File: file, key: key}, nil
+}
+
+func (l *Local) Stat(key string) (ObjectInfo, error) {
+	filePath, err := l.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := os.Stat(filePath)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return ObjectInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime(), ContentType: ContentType(key)}, nil
+}
+
+func (l *Local) Delete(key string) error {
+	filePath, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) DeletePrefix(prefix string) error {
+	dir, err := l.path(prefix)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func (l *Local) Walk(prefix string, fn func(ObjectInfo) error) error {
+	// Обходим только директорию, в которой могут лежать ключи с таким префиксом
+	start := filepath.Join(l.root, filepath.FromSlash(path.Dir(prefix+"x")))
+	err := filepath.WalkDir(start, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), tempPrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(l.root, filePath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return fn(ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime(), ContentType: ContentType(key)})
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config - параметры подключения к S3-совместимому хранилищу (AWS S3, MinIO)
+type S3Config struct {
+	Endpoint  string // Например "localhost:9000" для локального MinIO
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Region    string
+	UseSSL    bool
+}
+
+// S3 хранит объекты в бакете S3-совместимого хранилища
+type S3 struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3 подключается к хранилищу и создаёт бакет, если его ещё нет
+func NewS3(config S3Config) (*S3, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, errors.New("S3_ENDPOINT and S3_BUCKET are required for the s3 storage driver")
+	}
+
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure: config.UseSSL,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, config.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket %q: %w", config.Bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{Region: config.Region}); err != nil {
+			return nil, fmt.Errorf("failed to create bucket %q: %w", config.Bucket, err)
+		}
+	}
+
+	return &S3{client: client, bucket: config.Bucket}, nil
+}
+
+// s3Error переводит ошибку "нет такого ключа" в ErrNotFound
+func s3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	if code := minio.ToErrorResponse(err).Code; code == "NoSuchKey" || code == "NotFound" {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *S3) Put(key string, reader io.Reader, size int64, contentType string) error {
+	key, err := CleanKey(key)
+	if err != nil {
+		return err
+	}
+	if contentType == "" {
+		contentType = ContentType(key)
+	}
+	_, err = s.client.PutObject(context.Background(), s.bucket, key, reader, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+type s3Object struct {
+	*minio.Object
+	key string
+}
+
+func (o *s3Object) Stat() (ObjectInfo, error) {
+	info, err := o.Object.Stat()
+	if err != nil {
+		return ObjectInfo{}, s3Error(err)
+	}
+	return ObjectInfo{Key: o.key, Size: info.Size, ModTime: info.LastModified, ContentType: info.ContentType}, nil
+}
+
+func (s *S3) Open(key string) (Object, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	object, err := s.client.GetObject(context.Background(), s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+
+	// GetObject ленивый: запрос к хранилищу выполняется при первом чтении,
+	// поэтому отсутствие объекта проверяем сразу через Stat
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, s3Error(err)
+	}
+	return &s3Object{Object: object, key: key}, nil
+}
+
+func (s *S3) Stat(key string) (ObjectInfo, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := s.client.StatObject(context.Background(), s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, s3Error(err)
+	}
+	return ObjectInfo{Key: key, Size: info.Size, ModTime: info.LastModified, ContentType: info.ContentType}, nil
+}
+
+func (s *S3) Delete(key string) error {
+	key, err := CleanKey(key)
+	if err != nil {
+		return err
+	}
+	// S3 не возвращает ошибку при удалении несуществующего ключа
+	return s.client.RemoveObject(context.Background(), s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3) DeletePrefix(prefix string) error {
+	prefix, err := CleanKey(prefix)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	objects := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix + "/", Recursive: true})
+	for result := range s.client.RemoveObjects(ctx, s.bucket, objects, minio.RemoveObjectsOptions{}) {
+		if result.Err != nil {
+			return fmt.Errorf("failed to delete %q: %w", result.ObjectName, result.Err)
+		}
+	}
+	return nil
+}
+
+func (s *S3) Walk(prefix string, fn func(ObjectInfo) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: strings.TrimPrefix(prefix, "/"), Recursive: true}) {
+		if object.Err != nil {
+			return object.Err
+		}
+		err := fn(ObjectInfo{Key: object.Key, Size: object.Size, ModTime: object.LastModified, ContentType: ContentType(object.Key)})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ErrSignatureExpired - срок действия подписанного адреса истёк
+var ErrSignatureExpired = errors.New("signed url has expired")
+
+// ErrSignatureInvalid - подпись адреса отсутствует или не совпадает
+var ErrSignatureInvalid = errors.New("invalid url signature")
+
+// signingKey - ключ HMAC для подписанных адресов, настраивается в openSigningKey
+var signingKey []byte
+
+// openSigningKey читает ключ подписи из переменной окружения IMAGES_SIGNING_KEY.
+// Без него ключ создаётся случайно: адреса перестают действовать после перезапуска
+// и не принимаются другими экземплярами сервера.
+func openSigningKey() {
+	if key := os.Getenv("IMAGES_SIGNING_KEY"); key != "" {
+		signingKey = []byte(key)
+		return
+	}
+
+	signingKey = make([]byte, 32)
+	if _, err := rand.Read(signingKey); err != nil {
+		panic(err)
+	}
+	log.Println("IMAGES_SIGNING_KEY is not set, signed image URLs will not survive a restart")
+}
+
+// signature - HMAC-SHA256 от ключа объекта, срока действия и пользователя, укороченный до 128 бит
+func signature(key string, expires int64, userID uint) string {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(key + "\n" + strconv.FormatInt(expires, 10) + "\n" + strconv.FormatUint(uint64(userID), 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// SignedURL возвращает публичный адрес объекта, действующий до expires.
+// Если userID не 0, адрес принимается только от этого пользователя.
+func SignedURL(key string, userID uint, expires time.Time) string {
+	if key == "" {
+		return ""
+	}
+	if cleaned, err := CleanKey(key); err == nil {
+		key = cleaned
+	}
+	return URL(key) + "?" + SignedQuery(key, userID, expires)
+}
+
+// SignedQuery возвращает параметры expires, uid и sig, которыми подписывается ключ key.
+// Ключ не обязан быть объектом хранилища: так же подписываются и другие адреса, например скачивание главы.
+func SignedQuery(key string, userID uint, expires time.Time) string {
+	if cleaned, err := CleanKey(key); err == nil {
+		key = cleaned
+	}
+
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	if userID != 0 {
+		query.Set("uid", strconv.FormatUint(uint64(userID), 10))
+	}
+	query.Set("sig", signature(key, expires.Unix(), userID))
+	return query.Encode()
+}
+
+// VerifySignature проверяет параметры expires, uid и sig подписанного адреса объекта.
+// Возвращает пользователя, к которому привязан адрес, или 0, если адрес не привязан.
+func VerifySignature(key string, query url.Values) (uint, error) {
+	cleaned, err := CleanKey(key)
+	if err != nil {
+		return 0, err
+	}
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || query.Get("sig") == "" {
+		return 0, ErrSignatureInvalid
+	}
+	var userID uint64
+	if uid := query.Get("uid"); uid != "" {
+		if userID, err = strconv.ParseUint(uid, 10, 64); err != nil {
+			return 0, ErrSignatureInvalid
+		}
+	}
+
+	if !hmac.Equal([]byte(query.Get("sig")), []byte(signature(cleaned, expires, uint(userID)))) {
+		return 0, ErrSignatureInvalid
+	}
+	// Срок проверяется после подписи, чтобы подделанный адрес не выдавал себя за просроченный
+	if time.Now().Unix() > expires {
+		return 0, ErrSignatureExpired
+	}
+	return uint(userID), nil
+}
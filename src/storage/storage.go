@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotFound - объекта с таким ключом нет в хранилище
+var ErrNotFound = errors.New("object not found")
+
+// ErrInvalidKey - ключ пустой, абсолютный или выходит за пределы хранилища
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// ObjectInfo - сведения об объекте в хранилище
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+// Object - открытый для чтения объект. Поддерживает Seek, чтобы его можно было отдавать по частям.
+type Object interface {
+	io.ReadSeekCloser
+	Stat() (ObjectInfo, error)
+}
+
+// Storage - хранилище файлов, адресуемых ключами вида "<slug>/cover.jpg".
+// Ключи всегда разделяются "/", независимо от драйвера.
+type Storage interface {
+	// Put сохраняет объект. size может быть -1, если размер неизвестен.
+	Put(key string, reader io.Reader, size int64, contentType string) error
+	Open(key string) (Object, error)
+	Stat(key string) (ObjectInfo, error)
+	// Delete удаляет объект. Отсутствие объекта не считается ошибкой.
+	Delete(key string) error
+	// DeletePrefix удаляет все объекты, ключи которых начинаются с prefix + "/"
+	DeletePrefix(prefix string) error
+	// Walk вызывает fn для каждого объекта с ключом, начинающимся с prefix
+	Walk(prefix string, fn func(ObjectInfo) error) error
+}
+
+// Default - хранилище приложения, настраивается в Open
+var Default Storage
+
+// publicURL - адрес, по которому раздаются объекты хранилища.
+// Можно указать CDN через переменную окружения IMAGES_PUBLIC_URL.
+var publicURL = "/api/v1/images"
+
+// Open создаёт хранилище по переменным окружения:
+// STORAGE_DRIVER=local (по умолчанию) или s3.
+func Open() {
+	var err error
+
+	if base := os.Getenv("IMAGES_PUBLIC_URL"); base != "" {
+		publicURL = strings.TrimSuffix(base, "/")
+	}
+	openSigningKey()
+
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "local":
+		root := os.Getenv("STORAGE_LOCAL_ROOT")
+		if root == "" {
+			root = "./main/images"
+		}
+		Default, err = NewLocal(root)
+	case "s3":
+		Default, err = NewS3(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			UseSSL:    os.Getenv("S3_USE_SSL") == "true",
+		})
+	default:
+		err = fmt.Errorf("unknown storage driver %q", driver)
+	}
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Key собирает ключ из частей: Key("berserk", "cover.jpg") -> "berserk/cover.jpg"
+func Key(parts ...string) string {
+	return path.Join(parts...)
+}
+
+// URL возвращает публичный адрес объекта: "berserk/cover.jpg" -> "/api/v1/images/berserk/cover.jpg"
+func URL(key string) string {
+	if key == "" {
+		return ""
+	}
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return publicURL + "/" + strings.Join(segments, "/")
+}
+
+// CleanKey проверяет ключ и приводит его к каноническому виду, в котором он хранится
+func CleanKey(key string) (string, error) {
+	cleaned := path.Clean(strings.ReplaceAll(key, "\\", "/"))
+	if key == "" || cleaned == "." || strings.HasPrefix(cleaned, "/") || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return cleaned, nil
+}
+
+// tempPrefix - префикс временных файлов, в которые драйвер пишет объект до переименования
+const tempPrefix = ".upload-"
+
+// IsHiddenKey сообщает, что ключ указывает на служебный файл: временный файл записи
+// или другой файл, имя которого начинается с точки. Такие ключи не раздаются.
+func IsHiddenKey(key string) bool {
+	for _, segment := range strings.Split(key, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// ContentType определяет MIME тип по расширению ключа
+func ContentType(key string) string {
+	// Не во всех системных таблицах MIME есть современные форматы изображений
+	switch strings.ToLower(path.Ext(key)) {
+	case ".webp":
+		return "image/webp"
+	case ".avif":
+		return "image/avif"
+	}
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
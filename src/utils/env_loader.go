@@ -2,6 +2,8 @@ package utils
 
 import (
 	"log"
+	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -12,3 +14,28 @@ func LoadEnv() {
 		log.Fatal("---failed to load .env file---")
 	}
 }
+
+// GetEnv возвращает значение переменной окружения или значение по умолчанию
+func GetEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// GetDurationEnv читает длительность вида "720h" из переменной окружения.
+// Все длительности приложения - сроки и интервалы, поэтому нулевые и отрицательные значения
+// заменяются значением по умолчанию: time.NewTicker с ними падает, а нулевой срок молча всё просрочил бы.
+func GetDurationEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("Invalid duration in %s=%q, using %s", key, value, fallback)
+		return fallback
+	}
+	return duration
+}
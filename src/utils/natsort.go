@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NaturalLess сравнивает строки с учётом чисел внутри них: "page2" < "page10"
+func NaturalLess(a, b string) bool {
+	ar, br := []rune(strings.ToLower(a)), []rune(strings.ToLower(b))
+	i, j := 0, 0
+
+	for i < len(ar) && j < len(br) {
+		if unicode.IsDigit(ar[i]) && unicode.IsDigit(br[j]) {
+			// Выделяем числовые блоки целиком
+			si := i
+			for i < len(ar) && unicode.IsDigit(ar[i]) {
+				i++
+			}
+			sj := j
+			for j < len(br) && unicode.IsDigit(br[j]) {
+				j++
+			}
+
+			// Сравниваем числа без ведущих нулей: сначала по длине, затем посимвольно
+			na := strings.TrimLeft(string(ar[si:i]), "0")
+			nb := strings.TrimLeft(string(br[sj:j]), "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			// При равных значениях меньше тот, у кого меньше ведущих нулей
+			if i-si != j-sj {
+				return i-si < j-sj
+			}
+			continue
+		}
+
+		if ar[i] != br[j] {
+			return ar[i] < br[j]
+		}
+		i++
+		j++
+	}
+
+	return len(ar)-i < len(br)-j
+}
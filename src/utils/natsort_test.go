@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "p2", b: "p10", want: true},
+		{a: "p10", b: "p2", want: false},
+		{a: "page9.jpg", b: "page10.jpg", want: true},
+		{a: "ch1/p10", b: "ch2/p1", want: true},
+		{a: "P3", b: "p4", want: true},
+		{a: "p4", b: "P3", want: false},
+		{a: "p", b: "p1", want: true},
+		{a: "p1", b: "p1", want: false},
+
+		// Ведущие нули не меняют значение числа
+		{a: "007", b: "10", want: true},
+		{a: "010", b: "9", want: false},
+		{a: "001", b: "2", want: true},
+		// При равных значениях раньше идёт запись с меньшим числом нулей
+		{a: "1", b: "01", want: true},
+		{a: "01", b: "1", want: false},
+		{a: "p01a", b: "p1b", want: false},
+
+		{a: "12345678901234567890", b: "12345678901234567891", want: true},
+		{a: "страница 2", b: "страница 10", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" < "+tt.b, func(t *testing.T) {
+			if got := NaturalLess(tt.a, tt.b); got != tt.want {
+				t.Errorf("NaturalLess(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNaturalLessSort(t *testing.T) {
+	names := []string{"p10.jpg", "p2.jpg", "p1.jpg", "P01.jpg", "p001.jpg", "cover.jpg", "p20.jpg"}
+	want := []string{"cover.jpg", "p1.jpg", "P01.jpg", "p001.jpg", "p2.jpg", "p10.jpg", "p20.jpg"}
+
+	sort.SliceStable(names, func(i, j int) bool { return NaturalLess(names[i], names[j]) })
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("sorted = %v, want %v", names, want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/gosimple/unidecode"
+)
+
+// Сочетания латинских букв проверяются раньше одиночных, поэтому идут первыми
+var latinToCyrillic = []struct {
+	latin    string
+	cyrillic string
+}{
+	{"shch", "щ"}, {"sch", "щ"},
+	{"zh", "ж"}, {"kh", "х"}, {"ts", "ц"}, {"ch", "ч"}, {"sh", "ш"},
+	{"yu", "ю"}, {"ya", "я"}, {"yo", "ё"},
+	{"a", "а"}, {"b", "б"}, {"v", "в"}, {"g", "г"}, {"d", "д"}, {"e", "е"},
+	{"z", "з"}, {"i", "и"}, {"y", "й"}, {"j", "й"}, {"k", "к"}, {"l", "л"},
+	{"m", "м"}, {"n", "н"}, {"o", "о"}, {"p", "п"}, {"r", "р"}, {"s", "с"},
+	{"t", "т"}, {"u", "у"}, {"f", "ф"}, {"h", "х"}, {"c", "к"}, {"w", "в"},
+	{"x", "кс"}, {"q", "к"}, {"'", "ь"},
+}
+
+// ToLatin транслитерирует строку в латиницу в нижнем регистре: "Берсерк" -> "berserk"
+func ToLatin(text string) string {
+	return strings.ToLower(unidecode.Unidecode(text))
+}
+
+// ToCyrillic выполняет обратную транслитерацию латиницы в кириллицу: "berserk" -> "берсерк".
+// Преобразование приблизительное и предназначено только для поиска.
+func ToCyrillic(text string) string {
+	text = strings.ToLower(text)
+
+	var result strings.Builder
+	for len(text) > 0 {
+		matched := false
+		for _, pair := range latinToCyrillic {
+			if strings.HasPrefix(text, pair.latin) {
+				result.WriteString(pair.cyrillic)
+				text = text[len(pair.latin):]
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			// Символы вне таблицы (кириллица, цифры, пробелы) переносим как есть
+			r := []rune(text)[0]
+			result.WriteRune(r)
+			text = text[len(string(r)):]
+		}
+	}
+	return result.String()
+}